@@ -0,0 +1,311 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-log"
+	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
+	"github.com/gomatbase/go-we/security"
+	"github.com/gomatbase/go-we/util"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const (
+	// KeysAttributeName is the request scope attribute where handlers record the keys affected by the request
+	KeysAttributeName = "config-hub.audit.keys"
+
+	SuccessResult = "success"
+	FailureResult = "failure"
+
+	DefaultQueryLimit = 100
+
+	InvalidAuditEntryError = csn.ErrorF("invalid audit entry at line %d : %v")
+)
+
+var (
+	l, _     = log.GetWithOptions("AUDIT", log.Standard().WithFailingCriticals().WithStartingLevel(cfg.LogLevel))
+	auditLog *Log
+)
+
+// Log is an append-only, hash-chained audit log written as json lines, and forwarded as they are written
+type Log struct {
+	path       string
+	key        []byte
+	forwarders []io.Writer
+	file       *os.File
+	size       int64
+	sequence   int64
+	lastHash   string
+	mutex      sync.Mutex
+}
+
+// Setup opens the configured audit log, continuing its chain, forwarding its entries to stdout and the syslog drain
+func Setup() error {
+	if len(cfg.AuditKey) == 0 {
+		l.Warning("No AUDIT_KEY provided, the audit chain can be forged by anyone with access to the audit log")
+	}
+	forwarders := []io.Writer{os.Stdout}
+	if len(cfg.AuditSyslog) > 0 {
+		drain, e := url.Parse(cfg.AuditSyslog)
+		if e != nil {
+			return e
+		}
+		writer, e := syslog.Dial(drain.Scheme, drain.Host, syslog.LOG_INFO|syslog.LOG_AUTH, "config-hub")
+		if e != nil {
+			return e
+		}
+		forwarders = append(forwarders, writer)
+	}
+
+	var e error
+	auditLog, e = Open(cfg.AuditLog, []byte(cfg.AuditKey), forwarders...)
+	return e
+}
+
+// Open opens or creates the audit log at the given path, continuing the chain of the existing entries
+func Open(path string, key []byte, forwarders ...io.Writer) (*Log, error) {
+	auditLog := &Log{path: path, key: key, forwarders: forwarders}
+	if report, e := auditLog.read(nil, -1, 0); e != nil && !os.IsNotExist(e) {
+		return nil, e
+	} else if report != nil {
+		if !report.Valid {
+			l.Errorf("Audit log %s has been tampered with from entry %d on", path, *report.BrokenAt)
+		}
+		if count := len(report.Entries); count > 0 {
+			auditLog.sequence = report.Entries[count-1].Sequence
+			auditLog.lastHash = report.Entries[count-1].Hash
+		}
+	}
+
+	var e error
+	if auditLog.file, e = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); e != nil {
+		return nil, e
+	}
+	if info, e := auditLog.file.Stat(); e != nil {
+		return nil, e
+	} else {
+		auditLog.size = info.Size()
+	}
+	return auditLog, nil
+}
+
+// Append chains the entry to the previous ones, writes it and forwards it
+func (al *Log) Append(entry *domain.AuditEntry) error {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	entry.Sequence = al.sequence + 1
+	entry.PreviousHash = al.lastHash
+	entry.Hash = al.hash(entry)
+
+	line, e := json.Marshal(entry)
+	if e != nil {
+		return e
+	}
+	line = append(line, '\n')
+	if _, e = al.file.Write(line); e != nil {
+		return e
+	}
+	al.size += int64(len(line))
+	al.sequence = entry.Sequence
+	al.lastHash = entry.Hash
+	for _, forwarder := range al.forwarders {
+		if _, e = forwarder.Write(line); e != nil {
+			l.Errorf("Unable to forward audit entry %d : %v", entry.Sequence, e)
+		}
+	}
+	return nil
+}
+
+// Query verifies the whole chain and returns the most recent entries matching the filter, oldest first. Only the
+// entries written when the query starts are read, without blocking the entries being appended meanwhile.
+func (al *Log) Query(filter func(*domain.AuditEntry) bool, limit int) (*domain.AuditReport, error) {
+	al.mutex.Lock()
+	size, sequence := al.size, al.sequence
+	al.mutex.Unlock()
+
+	report, e := al.read(filter, size, sequence)
+	if e != nil {
+		return nil, e
+	}
+	if limit > 0 && len(report.Entries) > limit {
+		report.Entries = report.Entries[len(report.Entries)-limit:]
+	}
+	return report, nil
+}
+
+// read verifies the chain of the first size bytes of the log, or all of it when negative, which must end with the
+// given sequence
+func (al *Log) read(filter func(*domain.AuditEntry) bool, size int64, sequence int64) (*domain.AuditReport, error) {
+	file, e := os.Open(al.path)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = file.Close() }()
+
+	var reader io.Reader = file
+	if size >= 0 {
+		reader = io.LimitReader(file, size)
+	}
+
+	report := &domain.AuditReport{Valid: true, Keyed: len(al.key) > 0, Entries: []domain.AuditEntry{}}
+	broken := func(at int64) {
+		if report.Valid {
+			report.Valid = false
+			report.BrokenAt = &at
+		}
+	}
+	previousHash, previousSequence := "", int64(0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry domain.AuditEntry
+		if e = json.Unmarshal(scanner.Bytes(), &entry); e != nil {
+			return nil, InvalidAuditEntryError.WithValues(line, e)
+		}
+		if entry.Sequence != previousSequence+1 || entry.PreviousHash != previousHash || !hmac.Equal([]byte(entry.Hash), []byte(al.hash(&entry))) {
+			broken(entry.Sequence)
+		}
+		previousHash, previousSequence = entry.Hash, entry.Sequence
+		if filter == nil || filter(&entry) {
+			report.Entries = append(report.Entries, entry)
+		}
+	}
+	if e = scanner.Err(); e != nil {
+		return nil, e
+	}
+	// entries removed from the end of the log don't break the chain, the last sequence written tells them apart
+	if previousSequence < sequence {
+		broken(previousSequence + 1)
+	}
+	return report, nil
+}
+
+// hash returns the hmac-sha256 with the audit key, or the sha256 without a key, of the entry without its own hash,
+// chained to the previous hash
+func (al *Log) hash(entry *domain.AuditEntry) string {
+	unhashed := *entry
+	unhashed.Hash = ""
+	content, _ := json.Marshal(&unhashed)
+	if len(al.key) == 0 {
+		digest := sha256.Sum256(content)
+		return hex.EncodeToString(digest[:])
+	}
+	mac := hmac.New(sha256.New, al.key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Keys records the keys affected by the request in its audit entry
+func Keys(scope we.RequestScope, keys []string) {
+	scope.Set(KeysAttributeName, keys)
+}
+
+// Audited records an audit entry with the outcome of every call to the handler
+func Audited(action string, handler we.HandlerFunction) we.HandlerFunction {
+	return func(w we.ResponseWriter, scope we.RequestScope) error {
+		e := handler(w, scope)
+		if auditLog == nil {
+			return e
+		}
+
+		entry := &domain.AuditEntry{
+			Time:     time.Now().UTC(),
+			Action:   action,
+			Apps:     listParameter(scope.Parameter("apps")),
+			Profiles: listParameter(scope.Parameter("profiles")),
+			Labels:   listParameter(scope.Parameter("labels")),
+			ClientIp: ClientIp(scope.Request()),
+			Result:   SuccessResult,
+		}
+		if user, isUser := scope.Get(security.UserAttributeName).(*security.User); isUser {
+			entry.User = user.Username
+		}
+		entry.Source, _ = scope.LookupVar("source")
+		entry.Keys, _ = scope.Get(KeysAttributeName).([]string)
+		if e != nil {
+			entry.Result = FailureResult
+			entry.Error = e.Error()
+		}
+		if ae := auditLog.Append(entry); ae != nil {
+			l.Errorf("Unable to audit %s by %s : %v", action, entry.User, ae)
+		}
+		return e
+	}
+}
+
+// Handler returns the audit entries matching the user, action, app, since and until parameters, along with the
+// integrity of the audit chain
+func Handler(w we.ResponseWriter, scope we.RequestScope) error {
+	if auditLog == nil {
+		return events.NotFoundError
+	}
+
+	limit := DefaultQueryLimit
+	if parameter := scope.Parameter("limit"); len(parameter) > 0 {
+		var e error
+		if limit, e = strconv.Atoi(parameter); e != nil || limit < 1 {
+			return events.New(http.StatusBadRequest, "limit must be a positive number")
+		}
+	}
+	var since, until time.Time
+	for parameter, value := range map[string]*time.Time{"since": &since, "until": &until} {
+		if timestamp := scope.Parameter(parameter); len(timestamp) > 0 {
+			var e error
+			if *value, e = time.Parse(time.RFC3339, timestamp); e != nil {
+				return events.New(http.StatusBadRequest, parameter+" must be an RFC3339 timestamp")
+			}
+		}
+	}
+	user, action, app := scope.Parameter("user"), scope.Parameter("action"), scope.Parameter("app")
+
+	report, e := auditLog.Query(func(entry *domain.AuditEntry) bool {
+		return (len(user) == 0 || entry.User == user) &&
+			(len(action) == 0 || strings.HasPrefix(entry.Action, action)) &&
+			(len(app) == 0 || slices.Contains(entry.Apps, app)) &&
+			(since.IsZero() || !entry.Time.Before(since)) &&
+			(until.IsZero() || entry.Time.Before(until))
+	}, limit)
+	if e != nil {
+		return e
+	}
+	return util.ReplyJson(w, http.StatusOK, report)
+}
+
+// ClientIp returns the address of the client. Behind the cf router it is the last forwarded address, the one appended
+// by the router, as the previous ones are provided by the client.
+func ClientIp(request *http.Request) string {
+	if forwarded := request.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+		addresses := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	if host, _, e := net.SplitHostPort(request.RemoteAddr); e == nil {
+		return host
+	}
+	return request.RemoteAddr
+}
+
+func listParameter(parameter string) []string {
+	if len(parameter) == 0 {
+		return nil
+	}
+	return strings.Split(parameter, ",")
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestAuditChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	key := []byte("audit-key")
+	forwarded := &bytes.Buffer{}
+	auditLog, e := Open(path, key, forwarded)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for _, entry := range []*domain.AuditEntry{
+		{Time: time.Now().UTC(), User: "alice", Action: "secrets.add", Apps: []string{"payments"}, Keys: []string{"db.password"}, Result: SuccessResult},
+		{Time: time.Now().UTC(), User: "bob", Action: "secrets.delete", Apps: []string{"orders"}, Keys: []string{"api.key"}, Result: FailureResult},
+	} {
+		if e = auditLog.Append(entry); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	// reopening the log continues the chain
+	if auditLog, e = Open(path, key, forwarded); e != nil {
+		t.Fatal(e)
+	}
+	if e = auditLog.Append(&domain.AuditEntry{Time: time.Now().UTC(), User: "alice", Action: "cache.delete", Result: SuccessResult}); e != nil {
+		t.Fatal(e)
+	}
+
+	report, e := auditLog.Query(nil, 0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !report.Valid || !report.Keyed || len(report.Entries) != 3 {
+		t.Fatalf("expected a valid chain of 3 entries, got %+v", report)
+	}
+	for i, entry := range report.Entries {
+		if entry.Sequence != int64(i+1) {
+			t.Errorf("expected sequence %d, got %d", i+1, entry.Sequence)
+		}
+		if i > 0 && entry.PreviousHash != report.Entries[i-1].Hash {
+			t.Errorf("expected entry %d to be chained to the previous one", entry.Sequence)
+		}
+	}
+
+	if lines := strings.Count(forwarded.String(), "\n"); lines != 3 {
+		t.Errorf("expected the 3 entries to be forwarded, got %d", lines)
+	}
+
+	// a chain can't be verified without its key
+	if report, _ = (&Log{path: path, key: []byte("other-key")}).read(nil, -1, 0); report.Valid {
+		t.Errorf("expected the chain not to be verified with another key")
+	}
+
+	report, _ = auditLog.Query(func(entry *domain.AuditEntry) bool { return entry.User == "alice" }, 1)
+	if len(report.Entries) != 1 || report.Entries[0].Action != "cache.delete" {
+		t.Errorf("expected the most recent entry of alice, got %+v", report.Entries)
+	}
+
+	// tampering with an entry breaks the chain
+	content, _ := os.ReadFile(path)
+	if e = os.WriteFile(path, []byte(strings.Replace(string(content), "bob", "eve", 1)), 0600); e != nil {
+		t.Fatal(e)
+	}
+	if report, e = auditLog.Query(nil, 0); e != nil {
+		t.Fatal(e)
+	}
+	if report.Valid || report.BrokenAt == nil || *report.BrokenAt != 2 {
+		t.Errorf("expected the chain to be broken at entry 2")
+	}
+}
+
+func TestAuditTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, e := Open(path, []byte("audit-key"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, user := range []string{"alice", "bob", "carol"} {
+		if e = auditLog.Append(&domain.AuditEntry{Time: time.Now().UTC(), User: user, Action: "secrets.add", Result: SuccessResult}); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	// removing the last entry keeps a valid chain, but not the sequence the log has written
+	content, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(content), "\n")
+	if e = os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0600); e != nil {
+		t.Fatal(e)
+	}
+
+	report, e := auditLog.Query(nil, 0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if report.Valid || report.BrokenAt == nil || *report.BrokenAt != 3 {
+		t.Errorf("expected the truncated chain to be broken at entry 3, got %+v", report)
+	}
+}
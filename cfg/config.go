@@ -6,6 +6,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/gomatbase/csn"
 	"github.com/gomatbase/go-log"
@@ -26,16 +28,81 @@ var (
 	Client    = os.Getenv("CLIENT_ID")
 	Secret    = os.Getenv("CLIENT_SECRET")
 
+	// bearer tokens are validated locally with the keys published by the openid server, unless disabled. Tokens which
+	// can't be validated locally (opaque tokens, unavailable keys) are rejected unless the introspection fallback is on.
+	// Issuer and jwks uri default to the ones advertised by the openid configuration.
+	JwtLocalValidation       = os.Getenv("JWT_LOCAL_VALIDATION") != "false"
+	JwtIntrospectionFallback = os.Getenv("JWT_INTROSPECTION_FALLBACK") == "true"
+	JwtIssuer                = os.Getenv("JWT_ISSUER")
+	JwksUrl                  = os.Getenv("JWKS_URL")
+	JwtAudiences             []string
+	JwtClockSkew             = 30
+
 	// cf configuration
 	CfUrl             = "https://api.cf.internal"
 	ServiceInstanceId = os.Getenv("SERVICE_INSTANCE_ID")
 
+	// secrets management role of users allowed to manage the service instance in cf (space developers). Users with read
+	// access to the service instance are viewers. Other roles are granted with the config_hub_<instance>.<role> groups.
+	CfManageRole = domain.EditorRole
+
+	// reads are authorized per app with the config_hub_<instance>.read.<app> scope of each app read, the shared
+	// application configuration being readable with any of them. The config_hub_<instance>.read scope no longer grants
+	// read access to the configuration of all apps, apps relying on it must be granted their .read.<app> scopes. Instance
+	// wide read is deprecated and can only be restored temporarily with INSTANCE_WIDE_READ=true.
+	InstanceWideRead = os.Getenv("INSTANCE_WIDE_READ") == "true"
+
+	// cf instance identity authentication, enabled when the CA issuing the instance identity certificates is provided.
+	// InstanceIdentityApps maps the organization:<guid>, space:<guid> or app:<guid> of the certificates to the apps whose
+	// configuration they can read. Forwarded client certificates are only trusted if the router sanitizes them.
+	InstanceIdentityCa       = os.Getenv("INSTANCE_IDENTITY_CA")
+	InstanceIdentityApps     map[string][]string
+	TrustForwardedClientCert = os.Getenv("TRUST_FORWARDED_CLIENT_CERT") == "true"
+
+	// forwarded client certificates can only be trusted if the router replaces the header sent by clients, which must be
+	// asserted by setting the router forwarded_client_cert mode, sanitize_set
+	RouterForwardedClientCert = os.Getenv("ROUTER_FORWARDED_CLIENT_CERT")
+
+	// apps reaching config-hub directly, like over container networking, present their instance identity certificate in
+	// the tls handshake of the mutual tls listener, enabled with the port. The listener serves the container instance
+	// identity certificate unless another certificate is given.
+	MutualTlsPort  = os.Getenv("MUTUAL_TLS_PORT")
+	TlsCertificate = os.Getenv("TLS_CERTIFICATE_FILE")
+	TlsKey         = os.Getenv("TLS_KEY_FILE")
+
 	Port        = "8080"
 	HttpTimeout = 5
 	Sources     []domain.SourceConfig
 
 	OneTimeToken *string
 	BaseDir      string
+
+	// glob patterns of the keys whose values are masked for callers without the reveal privilege, and in logs
+	MaskedKeys []string
+
+	// PEM encoded RSA private key decrypting the secrets archives imported into this instance, the archives being
+	// exported from other instances with its public key. Archives can't be imported without it.
+	ArchivePrivateKey = os.Getenv("ARCHIVE_PRIVATE_KEY")
+
+	// credhub path of the api keys, api key authentication being enabled when set
+	ApiKeysPrefix = os.Getenv("API_KEYS_PREFIX")
+
+	// per client rate limits of the config reads, secrets writes and cache deletes, overridden with RATE_LIMITS, like
+	// {"reads": {"rate": 20, "burst": 100}, "cache": {"rate": 0}}, a rate of 0 disabling the limit. Apps presenting their
+	// instance identity are limited per app, all their instances sharing a limit, other clients per token subject or api
+	// key, and anonymous clients per address.
+	RateLimits = map[string]domain.RateLimit{
+		"reads":  {Rate: 10, Burst: 50},
+		"writes": {Rate: 1, Burst: 10},
+		"cache":  {Rate: 0.1, Burst: 3},
+	}
+
+	// json lines audit log of all mutating calls, in the base dir by default. The local file doesn't survive the
+	// instance, entries are also written to stdout (the cf log stream) and to the syslog drain, tcp://host:port or
+	// udp://host:port, for durable storage. The chain is keyed with the audit key, unkeyed chains can be forged.
+	AuditLog    = os.Getenv("AUDIT_LOG")
+	AuditKey    = os.Getenv("AUDIT_KEY")
+	AuditSyslog = os.Getenv("AUDIT_SYSLOG")
 )
 
 type CfApplication struct {
@@ -84,6 +151,24 @@ func FinishServerConfiguration() error {
 	if e != nil {
 		errors.AddErrorMessage(fmt.Sprintf("Unable to assess base dir : %v", e))
 	}
+	if len(AuditLog) == 0 {
+		AuditLog = path.Join(BaseDir, "audit.log")
+	}
+
+	if TrustForwardedClientCert && RouterForwardedClientCert != "sanitize_set" {
+		errors.AddErrorMessage("TRUST_FORWARDED_CLIENT_CERT requires the router to sanitize forwarded client certificates, assert it with ROUTER_FORWARDED_CLIENT_CERT=sanitize_set")
+	}
+	if len(MutualTlsPort) != 0 {
+		if len(InstanceIdentityCa) == 0 {
+			errors.AddErrorMessage("MUTUAL_TLS_PORT requires the INSTANCE_IDENTITY_CA")
+		}
+		if len(TlsCertificate) == 0 && len(TlsKey) == 0 {
+			TlsCertificate, TlsKey = os.Getenv("CF_INSTANCE_CERT"), os.Getenv("CF_INSTANCE_KEY")
+		}
+		if len(TlsCertificate) == 0 || len(TlsKey) == 0 {
+			errors.AddErrorMessage("MUTUAL_TLS_PORT requires a TLS_CERTIFICATE_FILE and TLS_KEY_FILE")
+		}
+	}
 
 	if vcap, found := os.LookupEnv("VCAP_APPLICATION"); found {
 		// running inside cf, get the cf url from the environment
@@ -97,6 +182,42 @@ func FinishServerConfiguration() error {
 		errors.AddErrorMessage("No CF_URL provided")
 	}
 
+	if role, found := os.LookupEnv("CF_MANAGE_ROLE"); found {
+		if CfManageRole, e = domain.ParseRole(role); e != nil {
+			errors.Add(e)
+		}
+	}
+
+	if maskedKeys := os.Getenv("MASKED_KEYS"); len(maskedKeys) > 0 {
+		MaskedKeys = strings.Split(maskedKeys, ",")
+	}
+
+	if audiences := os.Getenv("JWT_AUDIENCES"); len(audiences) > 0 {
+		JwtAudiences = strings.Split(audiences, ",")
+	}
+	if skew, found := os.LookupEnv("JWT_CLOCK_SKEW"); found {
+		if JwtClockSkew, e = strconv.Atoi(skew); e != nil || JwtClockSkew < 0 {
+			errors.AddErrorMessage(fmt.Sprintf("JWT_CLOCK_SKEW must be a positive number of seconds : %s", skew))
+		}
+	}
+
+	if rateLimits, found := os.LookupEnv("RATE_LIMITS"); found {
+		if e = json.Unmarshal([]byte(rateLimits), &RateLimits); e != nil {
+			errors.AddErrorMessage(fmt.Sprintf("Unable to parse RATE_LIMITS : %v", e))
+		}
+		for group, limit := range RateLimits {
+			if limit.Rate < 0 || (limit.Rate > 0 && limit.Burst < 1) {
+				errors.AddErrorMessage(fmt.Sprintf("Invalid rate limit for %s, rate must be positive and burst at least 1", group))
+			}
+		}
+	}
+
+	if identityApps, found := os.LookupEnv("INSTANCE_IDENTITY_APPS"); found {
+		if e = json.Unmarshal([]byte(identityApps), &InstanceIdentityApps); e != nil {
+			errors.AddErrorMessage(fmt.Sprintf("Unable to parse INSTANCE_IDENTITY_APPS : %v", e))
+		}
+	}
+
 	if credhubRef, found := os.LookupEnv("CREDHUB-REF"); found {
 		credhubClient, _ := credhub.New(nil)
 		if credentials, e := credhubClient.GetJsonByName(credhubRef); e != nil {
@@ -153,6 +274,41 @@ func jsonToSources(sources string) ([]domain.SourceConfig, error) {
 				} else {
 					sourcesArray[i] = gitConfig
 				}
+			case "consul":
+				consulConfig := &domain.ConsulConfig{}
+				if e := consulConfig.FromMap(properties); e != nil {
+					errors.Add(e)
+				} else {
+					sourcesArray[i] = consulConfig
+				}
+			case "keyvault":
+				keyVaultConfig := &domain.KeyVaultConfig{}
+				if e := keyVaultConfig.FromMap(properties); e != nil {
+					errors.Add(e)
+				} else {
+					sourcesArray[i] = keyVaultConfig
+				}
+			case "appconfig":
+				appConfigurationConfig := &domain.AppConfigurationConfig{}
+				if e := appConfigurationConfig.FromMap(properties); e != nil {
+					errors.Add(e)
+				} else {
+					sourcesArray[i] = appConfigurationConfig
+				}
+			case "http":
+				httpConfig := &domain.HttpConfig{}
+				if e := httpConfig.FromMap(properties); e != nil {
+					errors.Add(e)
+				} else {
+					sourcesArray[i] = httpConfig
+				}
+			case "env":
+				envConfig := &domain.EnvConfig{}
+				if e := envConfig.FromMap(properties); e != nil {
+					errors.Add(e)
+				} else {
+					sourcesArray[i] = envConfig
+				}
 			}
 		} else {
 			errors.AddErrorMessage(fmt.Sprintf("source without source type %v", properties))
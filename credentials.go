@@ -9,6 +9,7 @@ import (
 	"github.com/gomatbase/csn"
 	"github.com/rabobank/config-hub/cfg"
 	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/masking"
 	"github.com/rabobank/config-hub/util"
 )
 
@@ -35,6 +36,14 @@ func readProperties() map[string]string {
 	return properties
 }
 
+func toAny(properties map[string]string) map[string]any {
+	result := make(map[string]any, len(properties))
+	for k, v := range properties {
+		result[k] = v
+	}
+	return result
+}
+
 func isKeyPresent(properties map[string]string, key string) bool {
 	_, found := properties[key]
 	return found
@@ -47,12 +56,13 @@ func Credentials() error {
 	case "get":
 		cfg.Println("Reading properties")
 		properties := readProperties()
-		cfg.Println("properties :", properties)
+		cfg.Println("properties :", masking.Properties(toAny(properties), false))
 		if !isKeyPresent(properties, "host") || !isKeyPresent(properties, "protocol") {
 			return ExpectedHosAndProtocolError
 		}
 
 		request := &domain.CredentialsRequest{
+			Token:    cfg.OneTimeToken,
 			Protocol: properties["protocol"],
 			Host:     properties["host"],
 			Repo:     os.Args[len(os.Args)-2],
@@ -73,7 +83,7 @@ func Credentials() error {
 		fmt.Println(username)
 		cfg.Println(username)
 		fmt.Println(password)
-		cfg.Println(password)
+		cfg.Println("password=" + masking.Mask)
 	case "store":
 		readProperties()
 	case "erase":
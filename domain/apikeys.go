@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// ApiKey describes an api key granting a role to pipelines. The key itself is only returned when created, credhub only
+// holding its hash.
+type ApiKey struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type CreateApiKeyRequest struct {
+	Name          string `json:"name"`
+	Role          string `json:"role"`
+	ExpiresInDays int    `json:"expiresInDays,omitempty"`
+}
+
+type CreatedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
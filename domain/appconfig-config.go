@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gomatbase/csn"
+)
+
+const (
+	DefaultAppConfigurationProfileSeparator = "_"
+	DefaultAppConfigurationNullLabel        = "master"
+	DefaultAppConfigurationCacheTtl         = 60
+)
+
+type AppConfigurationConfig struct {
+	SourceType string `json:"type"`
+	Endpoint   string `json:"endpoint"`
+
+	// Keys of an application are expected under /<app>/ for the default profile and /<app><profileSeparator><profile>/
+	// for specific profiles. Key-values without a label are served for the config-hub label given as null label.
+	ProfileSeparator string `json:"profileSeparator,omitempty"`
+	NullLabel        string `json:"nullLabel,omitempty"`
+	CacheTtl         int    `json:"cacheTtl,omitempty"`
+
+	// Key vault references are only resolved against hosts under .vault.azure.net, or the given key vault hosts
+	KeyVaultHosts []string `json:"keyVaultHosts,omitempty"`
+
+	// Optional WIF issuer credentials for az Mi Wif credentials
+	Username *string `json:"username,omitempty"`
+	Password *string `json:"password,omitempty"`
+
+	AzureConfig
+}
+
+func (acc *AppConfigurationConfig) String() string {
+	return fmt.Sprintf("AppConfigurationConfig{Endpoint:%s, ProfileSeparator:%s, NullLabel:%s, CacheTtl:%d, KeyVaultHosts:%v, AzTenantId:%s, AzClient:%s, AzMiId:%s}",
+		acc.Endpoint, acc.ProfileSeparator, acc.NullLabel, acc.CacheTtl, acc.KeyVaultHosts, stringOrNull(acc.AzTenantId), stringOrNull(acc.AzClient), stringOrNull(acc.AzMiId))
+}
+
+func (acc *AppConfigurationConfig) Type() string {
+	return acc.SourceType
+}
+
+func (acc *AppConfigurationConfig) FromMap(properties map[string]any) error {
+	if properties == nil {
+		return nil
+	}
+
+	errors := csn.Errors()
+	errors.Add(extract(Mandatory, properties, "type", &acc.SourceType))
+	if acc.SourceType != AppConfigurationSourceType {
+		errors.AddErrorMessage(fmt.Sprintf("reading app configuration source configuration from incompatible source type : %s", acc.SourceType))
+	}
+
+	errors.Add(extract(Mandatory, properties, "endpoint", &acc.Endpoint))
+	if uri, e := url.Parse(acc.Endpoint); e != nil || uri.Scheme != "https" && uri.Scheme != "http" {
+		errors.AddErrorMessage(fmt.Sprintf("reading app configuration source configuration with invalid endpoint : %v", acc.Endpoint))
+	}
+	acc.Endpoint = strings.TrimSuffix(acc.Endpoint, "/")
+
+	acc.ProfileSeparator = DefaultAppConfigurationProfileSeparator
+	errors.Add(extract(Optional, properties, "profileSeparator", &acc.ProfileSeparator))
+	acc.NullLabel = DefaultAppConfigurationNullLabel
+	errors.Add(extract(Optional, properties, "nullLabel", &acc.NullLabel))
+
+	// json numbers are always read as floats
+	cacheTtl := float64(DefaultAppConfigurationCacheTtl)
+	errors.Add(extract(Optional, properties, "cacheTtl", &cacheTtl))
+	if acc.CacheTtl = int(cacheTtl); acc.CacheTtl < 0 {
+		acc.CacheTtl = DefaultAppConfigurationCacheTtl
+	}
+
+	acc.KeyVaultHosts = extractStrings(properties, "keyVaultHosts", errors)
+
+	errors.Add(extractPtr(Optional, properties, "username", &acc.Username))
+	errors.Add(extractPtr(Optional, properties, "password", &acc.Password))
+
+	acc.AzureConfig.fromMap(properties, acc.Username, acc.Password, errors)
+	if acc.AzTenantId == nil {
+		errors.AddErrorMessage("app configuration source requires an az SPN or MI configuration")
+	}
+
+	return errors.NilIfEmpty()
+}
@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// AuditEntry records a mutating call. Secret values are never recorded, only the affected keys. Each entry is chained
+// to the previous one with its hash, the hmac-sha256 with the audit key of the previous hash and the entry itself, so
+// tampering with an entry breaks the chain from that entry on.
+type AuditEntry struct {
+	Sequence     int64     `json:"sequence"`
+	Time         time.Time `json:"time"`
+	User         string    `json:"user"`
+	Action       string    `json:"action"`
+	Source       string    `json:"source,omitempty"`
+	Apps         []string  `json:"apps,omitempty"`
+	Profiles     []string  `json:"profiles,omitempty"`
+	Labels       []string  `json:"labels,omitempty"`
+	Keys         []string  `json:"keys,omitempty"`
+	ClientIp     string    `json:"clientIp"`
+	Result       string    `json:"result"`
+	Error        string    `json:"error,omitempty"`
+	PreviousHash string    `json:"previousHash"`
+	Hash         string    `json:"hash"`
+}
+
+// AuditReport holds the audit entries matching a query and whether the whole audit chain is intact, including entries
+// missing at the end of the log. Unkeyed chains only detect accidental changes.
+type AuditReport struct {
+	Valid    bool         `json:"valid"`
+	Keyed    bool         `json:"keyed"`
+	BrokenAt *int64       `json:"brokenAt,omitempty"`
+	Entries  []AuditEntry `json:"entries"`
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"github.com/gomatbase/csn"
+)
+
+// AzureConfig holds the identity used to access azure resources, either an app registration (SPN), optionally with
+// its secret stored in credhub, or a managed identity federated with a workload identity issuer (MI WIF)
+type AzureConfig struct {
+	// Optional parameters for azure based authentication with az app registration and credhub stored credentials
+	AzTenantId *string `json:"azTenantId,omitempty"`
+
+	// Spn based credentials az app registration and credhub stored credentials
+	AzSpn                    bool    `json:"-"`
+	AzClient                 *string `json:"azClient,omitempty"`
+	AzSecret                 *string `json:"azSecret,omitempty"`
+	AzSecretCredhubReference *string `json:"azSecret-credhub-ref,omitempty"`
+	AzSecretCredhubClient    *string `json:"azSecret-credhub-client,omitempty"`
+	AzSecretCredhubSecret    *string `json:"azSecret-credhub-secret,omitempty"`
+
+	// MI based credentials
+	AzMi          bool    `json:"-"`
+	AzMiId        *string `json:"azMiId,omitempty"`
+	AzMiWifIssuer *string `json:"azMiWifIssuer,omitempty"`
+	AzMiWifClient *string `json:"azMiWifClient,omitempty"`
+	AzMiWifSecret *string `json:"azMiWifSecret,omitempty"`
+}
+
+// fromMap reads the az identity configuration. The username and password are the workload identity issuer credentials
+// required by MI WIF identities, which each source type maps from its own configuration.
+func (ac *AzureConfig) fromMap(properties map[string]any, username, password *string, errors csn.IErrors) {
+	// extract az based credentials, if present
+	errors.Add(extractPtr(Optional, properties, "azTenantId", &ac.AzTenantId))
+	// Az SPN based credentials potentially with a credhub service instance holding the SPN secret
+	errors.Add(extractPtr(Optional, properties, "azClient", &ac.AzClient))
+	errors.Add(extractPtr(Optional, properties, "azSecret", &ac.AzSecret))
+	errors.Add(extractPtr(Optional, properties, "azSecret-credhub-ref", &ac.AzSecretCredhubReference))
+	errors.Add(extractPtr(Optional, properties, "azSecret-credhub-client", &ac.AzSecretCredhubClient))
+	errors.Add(extractPtr(Optional, properties, "azSecret-credhub-secret", &ac.AzSecretCredhubSecret))
+	// Az MI WIF based credentials (username and password would in this case have the WIF credentials
+	errors.Add(extractPtr(Optional, properties, "azMiId", &ac.AzMiId))
+	errors.Add(extractPtr(Optional, properties, "azMiWifIssuer", &ac.AzMiWifIssuer))
+	errors.Add(extractPtr(Optional, properties, "azMiWifClient", &ac.AzMiWifClient))
+	errors.Add(extractPtr(Optional, properties, "azMiWifSecret", &ac.AzMiWifSecret))
+
+	// if Tenant id is given check that either SPN or MI wif creadentials are fully given
+	if ac.AzTenantId != nil {
+
+		if ac.AzClient != nil || ac.AzSecret != nil || ac.AzSecretCredhubReference != nil {
+			if ac.AzClient == nil || ac.AzSecret == nil && ac.AzSecretCredhubReference == nil {
+				errors.AddErrorMessage("Invalid AZ SPN configuration. It requires Tenant ID, Client ID and Secret to be defined.")
+			} else {
+				ac.AzSpn = true
+			}
+		}
+
+		if ac.AzMiId != nil || ac.AzMiWifIssuer != nil {
+			if ac.AzMiId == nil || ac.AzMiWifIssuer == nil || username == nil || password == nil {
+				errors.AddErrorMessage("Invalid AZ MI configuration. It requires Tenant ID, Az MI name and WIF issuer credentials (username/password).")
+			} else {
+				ac.AzMi = true
+			}
+		}
+
+		if ac.AzSpn && ac.AzMi {
+			errors.AddErrorMessage("Configuring both AZ SPN and AZ MI is not supported")
+		} else if !ac.AzMi && !ac.AzSpn {
+			errors.AddErrorMessage("Az Tenant ID provided and neither a valid MI nor SPN configuration was provided")
+		}
+	}
+}
@@ -2,8 +2,13 @@ package domain
 
 // Supported source types
 const (
-	GitSourceType     = "git"
-	CredhubSourceType = "credhub"
+	GitSourceType              = "git"
+	CredhubSourceType          = "credhub"
+	ConsulSourceType           = "consul"
+	KeyVaultSourceType         = "keyvault"
+	AppConfigurationSourceType = "appconfig"
+	HttpSourceType             = "http"
+	EnvSourceType              = "env"
 )
 
 type Configuration struct {
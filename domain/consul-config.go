@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gomatbase/csn"
+)
+
+// Supported consul value layouts
+const (
+	ConsulKeyValueFormat   = "key-value"
+	ConsulYamlFormat       = "yaml"
+	ConsulPropertiesFormat = "properties"
+
+	DefaultConsulPrefix   = "config"
+	DefaultConsulDataKey  = "data"
+	DefaultConsulWaitTime = 300
+)
+
+type ConsulConfig struct {
+	SourceType       string  `json:"type"`
+	Url              string  `json:"url"`
+	Token            *string `json:"token,omitempty"`
+	Prefix           string  `json:"prefix,omitempty"`
+	ProfileSeparator string  `json:"profileSeparator,omitempty"`
+	Format           string  `json:"format,omitempty"`
+	DataKey          string  `json:"dataKey,omitempty"`
+	WaitTime         int     `json:"waitTime,omitempty"`
+}
+
+func (cc *ConsulConfig) String() string {
+	return fmt.Sprintf("ConsulConfig{Url:%s, Prefix:%s, ProfileSeparator:%s, Format:%s, DataKey:%s, Token:%v, WaitTime:%d}",
+		cc.Url, cc.Prefix, cc.ProfileSeparator, cc.Format, cc.DataKey, cc.Token != nil && len(*cc.Token) != 0, cc.WaitTime)
+}
+
+func (cc *ConsulConfig) Type() string {
+	return cc.SourceType
+}
+
+func (cc *ConsulConfig) FromMap(properties map[string]any) error {
+	if properties == nil {
+		return nil
+	}
+
+	errors := csn.Errors()
+	errors.Add(extract(Mandatory, properties, "type", &cc.SourceType))
+	if cc.SourceType != ConsulSourceType {
+		errors.AddErrorMessage(fmt.Sprintf("reading consul source configuration from incompatible source type : %s", cc.SourceType))
+	}
+
+	errors.Add(extract(Mandatory, properties, "url", &cc.Url))
+	if uri, e := url.Parse(cc.Url); e != nil || uri.Scheme != "http" && uri.Scheme != "https" {
+		errors.AddErrorMessage(fmt.Sprintf("reading consul source configuration with invalid url : %v", cc.Url))
+	}
+	cc.Url = strings.TrimSuffix(cc.Url, "/")
+
+	errors.Add(extractPtr(Optional, properties, "token", &cc.Token))
+
+	cc.Prefix = DefaultConsulPrefix
+	errors.Add(extract(Optional, properties, "prefix", &cc.Prefix))
+	cc.Prefix = strings.Trim(cc.Prefix, "/")
+
+	cc.ProfileSeparator = ","
+	errors.Add(extract(Optional, properties, "profileSeparator", &cc.ProfileSeparator))
+
+	cc.DataKey = DefaultConsulDataKey
+	errors.Add(extract(Optional, properties, "dataKey", &cc.DataKey))
+
+	cc.Format = ConsulKeyValueFormat
+	errors.Add(extract(Optional, properties, "format", &cc.Format))
+	switch cc.Format {
+	case ConsulKeyValueFormat, ConsulYamlFormat, ConsulPropertiesFormat:
+	default:
+		errors.AddErrorMessage(fmt.Sprintf("reading consul source configuration with unsupported format : %s", cc.Format))
+	}
+
+	// json numbers are always read as floats
+	waitTime := float64(DefaultConsulWaitTime)
+	errors.Add(extract(Optional, properties, "waitTime", &waitTime))
+	if cc.WaitTime = int(waitTime); cc.WaitTime <= 0 {
+		cc.WaitTime = DefaultConsulWaitTime
+	}
+
+	return errors.NilIfEmpty()
+}
@@ -2,15 +2,29 @@ package domain
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gomatbase/csn"
 )
 
+const (
+	DefaultCredhubSourceName = "credhub"
+	DefaultCredhubCacheTtl   = 60
+)
+
+// CredhubConfig configures a credhub source. Several credhub sources may be configured, each with its own prefix and
+// uaa client, as long as they have distinct names, which can't be the names of the secrets management endpoints. Like all
+// sources, the ones configured first take precedence.
 type CredhubConfig struct {
 	SourceType string  `json:"type"`
+	Name       string  `json:"name,omitempty"`
 	Client     *string `json:"client,omitempty"`
 	Secret     *string `json:"secret,omitempty"`
 	Prefix     string  `json:"prefix"`
+	CacheTtl   int     `json:"cacheTtl,omitempty"`
+
+	// url notified with the affected apps, profiles, labels and keys whenever secrets are rotated
+	NotificationUrl *string `json:"notificationUrl,omitempty"`
 }
 
 func (cc *CredhubConfig) Type() string {
@@ -28,10 +42,25 @@ func (cc *CredhubConfig) FromMap(properties map[string]interface{}) error {
 		errors.AddErrorMessage(fmt.Sprintf("reading credhub source configuration from incompatible source type : %s", cc.SourceType))
 	}
 
+	cc.Name = DefaultCredhubSourceName
+	errors.Add(extract(Optional, properties, "name", &cc.Name))
+	if len(cc.Name) == 0 || strings.Contains(cc.Name, "/") {
+		errors.AddErrorMessage(fmt.Sprintf("reading credhub source configuration with invalid name : %s", cc.Name))
+	}
+
 	errors.Add(extract(Mandatory, properties, "prefix", &cc.Prefix))
 	errors.Add(extractPtr(Optional, properties, "client", &cc.Client))
 	errors.Add(extractPtr(Optional, properties, "secret", &cc.Secret))
 
+	errors.Add(extractPtr(Optional, properties, "notificationUrl", &cc.NotificationUrl))
+
+	// a ttl of 0 disables caching
+	cacheTtl := float64(DefaultCredhubCacheTtl)
+	errors.Add(extract(Optional, properties, "cacheTtl", &cacheTtl))
+	if cc.CacheTtl = int(cacheTtl); cc.CacheTtl < 0 {
+		cc.CacheTtl = DefaultCredhubCacheTtl
+	}
+
 	if (cc.Client == nil) != (cc.Secret == nil) {
 		errors.AddErrorMessage("if either client or secret is provided both must be provided")
 	}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/gomatbase/csn"
+)
+
+type EnvConfig struct {
+	SourceType string `json:"type"`
+
+	// Applications and profiles the source is served for. Empty lists include the source for any app or profile
+	Apps     []string `json:"apps,omitempty"`
+	Profiles []string `json:"profiles,omitempty"`
+
+	// Allow-listed environment variables, mapped to their property names
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Allow-listed credentials of service instances bound to config-hub, by service instance name, mapping the
+	// (dot separated) credential path to the property name
+	Services map[string]map[string]string `json:"services,omitempty"`
+}
+
+func (ec *EnvConfig) String() string {
+	return fmt.Sprintf("EnvConfig{Apps:%v, Profiles:%v, Variables:%d, Services:%d}", ec.Apps, ec.Profiles, len(ec.Variables), len(ec.Services))
+}
+
+func (ec *EnvConfig) Type() string {
+	return ec.SourceType
+}
+
+func (ec *EnvConfig) FromMap(properties map[string]any) error {
+	if properties == nil {
+		return nil
+	}
+
+	errors := csn.Errors()
+	errors.Add(extract(Mandatory, properties, "type", &ec.SourceType))
+	if ec.SourceType != EnvSourceType {
+		errors.AddErrorMessage(fmt.Sprintf("reading env source configuration from incompatible source type : %s", ec.SourceType))
+	}
+
+	ec.Apps = extractStrings(properties, "apps", errors)
+	ec.Profiles = extractStrings(properties, "profiles", errors)
+
+	var variables map[string]any
+	errors.Add(extract(Optional, properties, "variables", &variables))
+	ec.Variables = toStringMap(variables, "variables", errors)
+
+	var services map[string]any
+	errors.Add(extract(Optional, properties, "services", &services))
+	ec.Services = make(map[string]map[string]string)
+	for service, mapping := range services {
+		if m, isType := mapping.(map[string]any); !isType {
+			errors.AddErrorMessage(fmt.Sprintf("reading env source configuration with invalid mapping for service %s : %v", service, mapping))
+		} else {
+			ec.Services[service] = toStringMap(m, "services."+service, errors)
+		}
+	}
+
+	if len(ec.Variables) == 0 && len(ec.Services) == 0 {
+		errors.AddErrorMessage("env source configuration requires at least one variable or service mapping")
+	}
+
+	return errors.NilIfEmpty()
+}
+
+func extractStrings(properties map[string]any, property string, errors csn.IErrors) []string {
+	var values []any
+	errors.Add(extract(Optional, properties, property, &values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, isType := value.(string); !isType {
+			errors.AddErrorMessage(fmt.Sprintf("reading source configuration with invalid %s value : %v", property, value))
+		} else {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func toStringMap(values map[string]any, property string, errors csn.IErrors) map[string]string {
+	result := make(map[string]string)
+	for key, value := range values {
+		if s, isType := value.(string); !isType {
+			errors.AddErrorMessage(fmt.Sprintf("reading source configuration with invalid %s.%s : %v", property, key, value))
+		} else {
+			result[key] = s
+		}
+	}
+	return result
+}
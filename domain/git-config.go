@@ -30,23 +30,8 @@ type GitConfig struct {
 	// Optional parameter for ssh private key
 	PrivateKey *string `json:"privateKey,omitempty"`
 
-	// Optional parameters for azure based authentication with az app registration and credhub stored credentials
-	AzTenantId *string `json:"azTenantId,omitempty"`
-
-	// Spn based credentials az app registration and credhub stored credentials
-	AzSpn                    bool    `json:"-"`
-	AzClient                 *string `json:"azClient,omitempty"`
-	AzSecret                 *string `json:"azSecret,omitempty"`
-	AzSecretCredhubReference *string `json:"azSecret-credhub-ref,omitempty"`
-	AzSecretCredhubClient    *string `json:"azSecret-credhub-client,omitempty"`
-	AzSecretCredhubSecret    *string `json:"azSecret-credhub-secret,omitempty"`
-
-	// MI based credentials
-	AzMi          bool    `json:"-"`
-	AzMiId        *string `json:"azMiId,omitempty"`
-	AzMiWifIssuer *string `json:"azMiWifIssuer,omitempty"`
-	AzMiWifClient *string `json:"azMiWifClient,omitempty"`
-	AzMiWifSecret *string `json:"azMiWifSecret,omitempty"`
+	// Optional azure identity, az MI WIF credentials use the username and password
+	AzureConfig
 }
 
 func stringOrNull(value *string) string {
@@ -112,45 +97,7 @@ func (gc *GitConfig) FromMap(properties map[string]any) error {
 		gc.FetchCacheTtl = DefaultFetchCacheTtl
 	}
 
-	// extract az based credentials, if present
-	errors.Add(extractPtr(Optional, properties, "azTenantId", &gc.AzTenantId))
-	// Az SPN based credentials potentially with a credhub service instance holding the SPN secret
-	errors.Add(extractPtr(Optional, properties, "azClient", &gc.AzClient))
-	errors.Add(extractPtr(Optional, properties, "azSecret", &gc.AzSecret))
-	errors.Add(extractPtr(Optional, properties, "azSecret-credhub-ref", &gc.AzSecretCredhubReference))
-	errors.Add(extractPtr(Optional, properties, "azSecret-credhub-client", &gc.AzSecretCredhubClient))
-	errors.Add(extractPtr(Optional, properties, "azSecret-credhub-secret", &gc.AzSecretCredhubSecret))
-	// Az MI WIF based credentials (username and password would in this case have the WIF credentials
-	errors.Add(extractPtr(Optional, properties, "azMiId", &gc.AzMiId))
-	errors.Add(extractPtr(Optional, properties, "azMiWifIssuer", &gc.AzMiWifIssuer))
-	errors.Add(extractPtr(Optional, properties, "azMiWifClient", &gc.AzMiWifClient))
-	errors.Add(extractPtr(Optional, properties, "azMiWifSecret", &gc.AzMiWifSecret))
-
-	// if Tenant id is given check that either SPN or MI wif creadentials are fully given
-	if gc.AzTenantId != nil {
-
-		if gc.AzClient != nil || gc.AzSecret != nil || gc.AzSecretCredhubReference != nil {
-			if gc.AzClient == nil || gc.AzSecret == nil && gc.AzSecretCredhubReference == nil {
-				errors.AddErrorMessage("Invalid AZ SPN configuration. It requires Tenant ID, Client ID and Secret to be defined.")
-			} else {
-				gc.AzSpn = true
-			}
-		}
-
-		if gc.AzMiId != nil || gc.AzMiWifIssuer != nil {
-			if gc.AzMiId == nil || gc.AzMiWifIssuer == nil || gc.Username == nil || gc.Password == nil {
-				errors.AddErrorMessage("Invalid AZ MI configuration. It requires Tenant ID, Az MI name and WIF issuer credentials (username/password).")
-			} else {
-				gc.AzMi = true
-			}
-		}
-
-		if gc.AzSpn && gc.AzMi {
-			errors.AddErrorMessage("Configuring both AZ SPN and AZ MI is not supported")
-		} else if !gc.AzMi && !gc.AzSpn {
-			errors.AddErrorMessage("Az Tenant ID provided and neither a valid MI nor SPN configuration was provided")
-		}
-	}
+	gc.AzureConfig.fromMap(properties, gc.Username, gc.Password, errors)
 
 	return errors.NilIfEmpty()
 }
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gomatbase/csn"
+)
+
+// Supported http source authentication methods
+const (
+	HttpNoAuthentication     = "none"
+	HttpBearerAuthentication = "bearer"
+	HttpBasicAuthentication  = "basic"
+	HttpOAuthAuthentication  = "oauth"
+)
+
+type HttpConfig struct {
+	SourceType        string `json:"type"`
+	Uri               string `json:"uri"`
+	SkipSslValidation bool   `json:"skipSslValidation"`
+	Authentication    string `json:"authentication,omitempty"`
+
+	// bearer authentication
+	Token *string `json:"token,omitempty"`
+
+	// basic authentication
+	Username *string `json:"username,omitempty"`
+	Password *string `json:"password,omitempty"`
+
+	// oauth client credentials authentication
+	TokenUri     *string  `json:"tokenUri,omitempty"`
+	ClientId     *string  `json:"clientId,omitempty"`
+	ClientSecret *string  `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+func (hc *HttpConfig) String() string {
+	return fmt.Sprintf("HttpConfig{Uri:%s, Authentication:%s, SkipSslValidation:%v, Username:%s, TokenUri:%s, ClientId:%s}",
+		hc.Uri, hc.Authentication, hc.SkipSslValidation, stringOrNull(hc.Username), stringOrNull(hc.TokenUri), stringOrNull(hc.ClientId))
+}
+
+func (hc *HttpConfig) Type() string {
+	return hc.SourceType
+}
+
+func (hc *HttpConfig) FromMap(properties map[string]any) error {
+	if properties == nil {
+		return nil
+	}
+
+	errors := csn.Errors()
+	errors.Add(extract(Mandatory, properties, "type", &hc.SourceType))
+	if hc.SourceType != HttpSourceType {
+		errors.AddErrorMessage(fmt.Sprintf("reading http source configuration from incompatible source type : %s", hc.SourceType))
+	}
+
+	errors.Add(extract(Mandatory, properties, "uri", &hc.Uri))
+	if uri, e := url.Parse(hc.Uri); e != nil || uri.Scheme != "http" && uri.Scheme != "https" {
+		errors.AddErrorMessage(fmt.Sprintf("reading http source configuration with invalid uri : %v", hc.Uri))
+	}
+	hc.Uri = strings.TrimSuffix(hc.Uri, "/")
+	errors.Add(extract(Optional, properties, "skipSslValidation", &hc.SkipSslValidation))
+
+	errors.Add(extractPtr(Optional, properties, "token", &hc.Token))
+	errors.Add(extractPtr(Optional, properties, "username", &hc.Username))
+	errors.Add(extractPtr(Optional, properties, "password", &hc.Password))
+	errors.Add(extractPtr(Optional, properties, "tokenUri", &hc.TokenUri))
+	errors.Add(extractPtr(Optional, properties, "clientId", &hc.ClientId))
+	errors.Add(extractPtr(Optional, properties, "clientSecret", &hc.ClientSecret))
+
+	var scopes []any
+	errors.Add(extract(Optional, properties, "scopes", &scopes))
+	for _, scope := range scopes {
+		if s, isType := scope.(string); !isType {
+			errors.AddErrorMessage(fmt.Sprintf("reading http source configuration with invalid scope : %v", scope))
+		} else {
+			hc.Scopes = append(hc.Scopes, s)
+		}
+	}
+
+	hc.Authentication = HttpNoAuthentication
+	errors.Add(extract(Optional, properties, "authentication", &hc.Authentication))
+	switch hc.Authentication {
+	case HttpNoAuthentication:
+	case HttpBearerAuthentication:
+		if hc.Token == nil {
+			errors.AddErrorMessage("http source bearer authentication requires a token")
+		}
+	case HttpBasicAuthentication:
+		if hc.Username == nil || hc.Password == nil {
+			errors.AddErrorMessage("http source basic authentication requires a username and password")
+		}
+	case HttpOAuthAuthentication:
+		if hc.TokenUri == nil || hc.ClientId == nil || hc.ClientSecret == nil {
+			errors.AddErrorMessage("http source oauth authentication requires a token uri, client id and client secret")
+		}
+	default:
+		errors.AddErrorMessage(fmt.Sprintf("reading http source configuration with unsupported authentication : %s", hc.Authentication))
+	}
+
+	return errors.NilIfEmpty()
+}
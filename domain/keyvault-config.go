@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gomatbase/csn"
+)
+
+const (
+	DefaultKeyVaultNameSeparator  = "--"
+	DefaultKeyVaultDotReplacement = "-"
+	DefaultKeyVaultCacheTtl       = 300
+)
+
+type KeyVaultConfig struct {
+	SourceType string `json:"type"`
+	VaultUri   string `json:"vaultUri"`
+
+	// Secret names are expected to follow <app><separator><profile><separator><key> (or <app><separator><key> for
+	// the default profile), where the dot replacement in the key is translated back into dots
+	NameSeparator  string `json:"nameSeparator,omitempty"`
+	DotReplacement string `json:"dotReplacement,omitempty"`
+	CacheTtl       int    `json:"cacheTtl,omitempty"`
+
+	// Optional WIF issuer credentials for az Mi Wif credentials
+	Username *string `json:"username,omitempty"`
+	Password *string `json:"password,omitempty"`
+
+	AzureConfig
+}
+
+func (kvc *KeyVaultConfig) String() string {
+	return fmt.Sprintf("KeyVaultConfig{VaultUri:%s, NameSeparator:%s, DotReplacement:%s, CacheTtl:%d, AzTenantId:%s, AzClient:%s, AzMiId:%s}",
+		kvc.VaultUri, kvc.NameSeparator, kvc.DotReplacement, kvc.CacheTtl, stringOrNull(kvc.AzTenantId), stringOrNull(kvc.AzClient), stringOrNull(kvc.AzMiId))
+}
+
+func (kvc *KeyVaultConfig) Type() string {
+	return kvc.SourceType
+}
+
+func (kvc *KeyVaultConfig) FromMap(properties map[string]any) error {
+	if properties == nil {
+		return nil
+	}
+
+	errors := csn.Errors()
+	errors.Add(extract(Mandatory, properties, "type", &kvc.SourceType))
+	if kvc.SourceType != KeyVaultSourceType {
+		errors.AddErrorMessage(fmt.Sprintf("reading key vault source configuration from incompatible source type : %s", kvc.SourceType))
+	}
+
+	errors.Add(extract(Mandatory, properties, "vaultUri", &kvc.VaultUri))
+	if uri, e := url.Parse(kvc.VaultUri); e != nil || uri.Scheme != "https" && uri.Scheme != "http" {
+		errors.AddErrorMessage(fmt.Sprintf("reading key vault source configuration with invalid vault uri : %v", kvc.VaultUri))
+	}
+	kvc.VaultUri = strings.TrimSuffix(kvc.VaultUri, "/")
+
+	kvc.NameSeparator = DefaultKeyVaultNameSeparator
+	errors.Add(extract(Optional, properties, "nameSeparator", &kvc.NameSeparator))
+	kvc.DotReplacement = DefaultKeyVaultDotReplacement
+	errors.Add(extract(Optional, properties, "dotReplacement", &kvc.DotReplacement))
+	if len(kvc.NameSeparator) == 0 {
+		errors.AddErrorMessage("key vault name separator cannot be empty")
+	}
+
+	// json numbers are always read as floats
+	cacheTtl := float64(DefaultKeyVaultCacheTtl)
+	errors.Add(extract(Optional, properties, "cacheTtl", &cacheTtl))
+	if kvc.CacheTtl = int(cacheTtl); kvc.CacheTtl < 0 {
+		kvc.CacheTtl = DefaultKeyVaultCacheTtl
+	}
+
+	errors.Add(extractPtr(Optional, properties, "username", &kvc.Username))
+	errors.Add(extractPtr(Optional, properties, "password", &kvc.Password))
+
+	kvc.AzureConfig.fromMap(properties, kvc.Username, kvc.Password, errors)
+	if kvc.AzTenantId == nil {
+		errors.AddErrorMessage("key vault source requires an az SPN or MI configuration")
+	}
+
+	return errors.NilIfEmpty()
+}
@@ -0,0 +1,8 @@
+package domain
+
+// RateLimit is the token bucket of each client for a group of routes, refilled with Rate requests per second up to
+// Burst requests. A rate of 0 disables the limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
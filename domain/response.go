@@ -12,4 +12,7 @@ type Configs struct {
 type PropertySource struct {
 	Source     string                 `json:"name"`
 	Properties map[string]interface{} `json:"source"`
+
+	// keys holding secrets in sources mixing secrets with plain values, masked for callers without the reveal privilege
+	SecretKeys []string `json:"-"`
 }
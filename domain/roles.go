@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"strings"
+
+	"github.com/gomatbase/csn"
+)
+
+// Role is the secrets management role of a user, each role granting the permissions of the lower ones
+type Role int
+
+const (
+	NoRole Role = iota
+	// ViewerRole lists secret names, their metadata and history
+	ViewerRole
+	// EditorRole adds, updates, copies and rotates secrets
+	EditorRole
+	// AdminRole deletes, rolls back, exports and imports secrets
+	AdminRole
+
+	// RoleAttributeName is the request scope attribute holding the role of the authenticated user
+	RoleAttributeName = "config-hub.role"
+
+	UnknownRoleError = csn.ErrorF("unknown role %s, expecting viewer, editor or admin")
+)
+
+var roleNames = []string{"none", "viewer", "editor", "admin"}
+
+func (r Role) String() string {
+	if r < NoRole || int(r) >= len(roleNames) {
+		return roleNames[NoRole]
+	}
+	return roleNames[r]
+}
+
+func ParseRole(name string) (Role, error) {
+	for i, roleName := range roleNames[ViewerRole:] {
+		if strings.EqualFold(name, roleName) {
+			return ViewerRole + Role(i), nil
+		}
+	}
+	return NoRole, UnknownRoleError.WithValues(name)
+}
@@ -1,8 +1,128 @@
 package domain
 
+import "time"
+
 type SecretName struct {
 	App     string `json:"app"`
 	Profile string `json:"profile"`
 	Label   string `json:"label"`
 	Name    string `json:"name"`
 }
+
+// SecretVersion describes a version of the secrets of an app/profile/label, listing the names of the keys that changed
+// compared to the previous version but never their values
+type SecretVersion struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Added     []string  `json:"added,omitempty"`
+	Changed   []string  `json:"changed,omitempty"`
+	Removed   []string  `json:"removed,omitempty"`
+}
+
+type SecretHistory struct {
+	App      string          `json:"app"`
+	Profile  string          `json:"profile"`
+	Label    string          `json:"label"`
+	Versions []SecretVersion `json:"versions"`
+}
+
+type RollbackRequest struct {
+	Version string `json:"version"`
+}
+
+// SecretsArchive is an export of the secrets of a credhub source. The exported secrets are encrypted with a random
+// AES-256-GCM key, which is in turn encrypted with the RSA public key provided by the caller using RSA-OAEP (SHA-256).
+// Archives are imported as they are exported, decrypted with the archive private key of the importing instance.
+type SecretsArchive struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+	Key       string `json:"key"`
+	Nonce     string `json:"nonce"`
+	Data      string `json:"data"`
+}
+
+// ExportedSecrets is the content of a secrets archive, with the secrets named relative to the source prefix
+type ExportedSecrets struct {
+	Source     string           `json:"source"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Secrets    []ExportedSecret `json:"secrets"`
+}
+
+type ExportedSecret struct {
+	App     string         `json:"app"`
+	Profile string         `json:"profile"`
+	Label   string         `json:"label"`
+	Secrets map[string]any `json:"secrets"`
+}
+
+type ExportRequest struct {
+	PublicKey string `json:"publicKey"`
+}
+
+// ImportChange reports what importing the secrets of an app/profile/label did, or would do in a dry-run
+type ImportChange struct {
+	App     string   `json:"app"`
+	Profile string   `json:"profile"`
+	Label   string   `json:"label"`
+	Action  string   `json:"action"`
+	Added   []string `json:"added,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool           `json:"dryRun"`
+	Policy  string         `json:"policy"`
+	Changes []ImportChange `json:"changes"`
+}
+
+type SecretScope struct {
+	App     string `json:"app"`
+	Profile string `json:"profile"`
+	Label   string `json:"label"`
+}
+
+// CopyRequest copies the secrets of an app/profile/label to another. When keys are given only those keys, and the keys
+// nested in them, are copied.
+type CopyRequest struct {
+	From  SecretScope `json:"from"`
+	To    SecretScope `json:"to"`
+	Keys  []string    `json:"keys,omitempty"`
+	Force bool        `json:"force,omitempty"`
+}
+
+type CopiedSecret struct {
+	Key    string `json:"key"`
+	Result string `json:"result"`
+}
+
+// RotatedSecrets lists the keys regenerated for an app/profile/label, it is also the payload of rotation notifications
+type RotatedSecrets struct {
+	Source  string   `json:"source"`
+	App     string   `json:"app"`
+	Profile string   `json:"profile"`
+	Label   string   `json:"label"`
+	Keys    []string `json:"keys"`
+}
+
+// SecretMetadata documents a secret key, it is kept in a credential next to the secrets
+type SecretMetadata struct {
+	Owner       string     `json:"owner,omitempty"`
+	Description string     `json:"description,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Ticket      string     `json:"ticket,omitempty"`
+}
+
+type SecretEntry struct {
+	Name     string          `json:"name"`
+	Metadata *SecretMetadata `json:"metadata,omitempty"`
+}
+
+type ExpiringSecret struct {
+	App      string         `json:"app"`
+	Profile  string         `json:"profile"`
+	Label    string         `json:"label"`
+	Key      string         `json:"key"`
+	Expired  bool           `json:"expired"`
+	Metadata SecretMetadata `json:"metadata"`
+}
@@ -0,0 +1,91 @@
+package masking
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rabobank/config-hub/cfg"
+)
+
+// Mask replaces masked values
+const Mask = "******"
+
+var (
+	// DefaultKeyPatterns are the case-insensitive glob patterns of keys holding secrets
+	DefaultKeyPatterns = []string{"*password*", "*secret*", "*token*"}
+
+	keyMatchers []*regexp.Regexp
+	initialize  sync.Once
+)
+
+// matchers compiles the configured key patterns, or the default ones, into regular expressions
+func matchers() []*regexp.Regexp {
+	initialize.Do(func() {
+		patterns := DefaultKeyPatterns
+		if len(cfg.MaskedKeys) > 0 {
+			patterns = cfg.MaskedKeys
+		}
+		for _, pattern := range patterns {
+			expression := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(strings.TrimSpace(pattern))), `\*`, ".*")
+			keyMatchers = append(keyMatchers, regexp.MustCompile("^"+expression+"$"))
+		}
+	})
+	return keyMatchers
+}
+
+// IsSensitiveKey checks if the key matches any of the masked key patterns
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, matcher := range matchers() {
+		if matcher.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Properties returns a copy of the flat properties with the values of sensitive keys masked, or all values if the
+// properties come from a secrets source
+func Properties(properties map[string]any, secrets bool) map[string]any {
+	masked := make(map[string]any, len(properties))
+	for key, value := range properties {
+		masked[key] = Value(key, value, secrets)
+	}
+	return masked
+}
+
+// Value masks the value of the key if it is sensitive, or if forced to, descending into nested objects and lists
+func Value(key string, value any, force bool) any {
+	force = force || IsSensitiveKey(key)
+	switch typed := value.(type) {
+	case map[string]any:
+		masked := make(map[string]any, len(typed))
+		for k, v := range typed {
+			masked[k] = Value(k, v, force)
+		}
+		return masked
+	case []any:
+		masked := make([]any, len(typed))
+		for i, v := range typed {
+			masked[i] = Value(key, v, force)
+		}
+		return masked
+	default:
+		if force && value != nil {
+			return Mask
+		}
+		return value
+	}
+}
+
+// Json masks the sensitive values of a json document, for logging. Content which isn't json is masked entirely.
+func Json(content []byte) string {
+	var document any
+	if e := json.Unmarshal(content, &document); e != nil {
+		return Mask
+	}
+	masked, _ := json.Marshal(Value("", document, false))
+	return string(masked)
+}
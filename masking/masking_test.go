@@ -0,0 +1,46 @@
+package masking
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSensitiveKey(t *testing.T) {
+	for key, expected := range map[string]bool{
+		"spring.datasource.password": true,
+		"client-Secret":              true,
+		"github.token.value":         true,
+		"spring.datasource.url":      false,
+		"username":                   false,
+	} {
+		if IsSensitiveKey(key) != expected {
+			t.Errorf("expected %s sensitive to be %v", key, expected)
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	properties := map[string]any{"db.url": "jdbc:x", "db.password": "p", "list": []any{"a"}, "nested": map[string]any{"token": "t", "id": 1}}
+
+	expected := map[string]any{"db.url": "jdbc:x", "db.password": Mask, "list": []any{"a"}, "nested": map[string]any{"token": Mask, "id": 1}}
+	if masked := Properties(properties, false); !reflect.DeepEqual(masked, expected) {
+		t.Errorf("expected %v, got %v", expected, masked)
+	}
+
+	expected = map[string]any{"db.url": Mask, "db.password": Mask, "list": []any{Mask}, "nested": map[string]any{"token": Mask, "id": Mask}}
+	if masked := Properties(properties, true); !reflect.DeepEqual(masked, expected) {
+		t.Errorf("expected all secrets values to be masked, got %v", masked)
+	}
+	if properties["db.password"] != "p" {
+		t.Errorf("expected the properties not to be modified")
+	}
+}
+
+func TestJson(t *testing.T) {
+	if masked := Json([]byte(`{"username":"u","password":"p"}`)); masked != `{"password":"******","username":"u"}` {
+		t.Errorf("unexpected masked json %s", masked)
+	}
+	if masked := Json([]byte("password=p")); masked != Mask {
+		t.Errorf("expected content which isn't json to be masked")
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/go-we"
+)
+
+// all config-hub metrics are published under a single expvar map, served as json by the metrics endpoint
+var (
+	registry = expvar.NewMap("config_hub")
+	groups   sync.Mutex
+)
+
+// Group returns the metrics group with the given name, creating it if it doesn't exist yet
+func Group(name string) *expvar.Map {
+	groups.Lock()
+	defer groups.Unlock()
+
+	if group, isMap := registry.Get(name).(*expvar.Map); isMap {
+		return group
+	}
+	group := new(expvar.Map)
+	registry.Set(name, group)
+	return group
+}
+
+// Latency records the calls, failures and latency of calls to a dependency
+type Latency struct {
+	calls    expvar.Int
+	failures expvar.Int
+	totalMs  expvar.Int
+	maxMs    expvar.Int
+	mutex    sync.Mutex
+}
+
+func NewLatency(group *expvar.Map, name string) *Latency {
+	latency := &Latency{}
+	metrics := new(expvar.Map)
+	metrics.Set("calls", &latency.calls)
+	metrics.Set("failures", &latency.failures)
+	metrics.Set("latency_ms_total", &latency.totalMs)
+	metrics.Set("latency_ms_max", &latency.maxMs)
+	group.Set(name, metrics)
+	return latency
+}
+
+// Observe records a call started at start, failed if e is not nil
+func (l *Latency) Observe(start time.Time, e error) {
+	elapsed := time.Since(start).Milliseconds()
+	l.calls.Add(1)
+	if e != nil {
+		l.failures.Add(1)
+	}
+	l.totalMs.Add(elapsed)
+
+	l.mutex.Lock()
+	if elapsed > l.maxMs.Value() {
+		l.maxMs.Set(elapsed)
+	}
+	l.mutex.Unlock()
+}
+
+func Handler(w we.ResponseWriter, _ we.RequestScope) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, e := w.Write([]byte(registry.String()))
+	return e
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/credhub_source"
+	"github.com/rabobank/config-hub/util"
+	"github.com/rabobank/credhub-client"
+)
+
+// storedApiKey is the api key as stored in credhub, with the sha256 of its secret
+type storedApiKey struct {
+	domain.ApiKey
+	Hash string `json:"hash"`
+}
+
+type cachedApiKey struct {
+	key     *storedApiKey
+	expires time.Time
+}
+
+// apiKeyStore keeps the api keys in credhub, one credential per key named after the key id
+type apiKeyStore struct {
+	client credhub.Client
+	prefix string
+	cache  map[string]*cachedApiKey
+	swept  time.Time
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+func newApiKeyStore(client credhub.Client, prefix string) *apiKeyStore {
+	return &apiKeyStore{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/", cache: make(map[string]*cachedApiKey), now: time.Now}
+}
+
+// apiKeysClient returns the credhub client of the default credhub source, or one authenticated with the instance
+// identity when no credhub source is configured
+func apiKeysClient() (credhub.Client, error) {
+	if client := credhub_source.DefaultClient(); client != nil {
+		return client, nil
+	}
+	return util.CredhubClient(nil, nil)
+}
+
+// validApiKeyId checks the id is a generated one, as it is part of the credential name
+func validApiKeyId(id string) bool {
+	_, e := hex.DecodeString(id)
+	return e == nil && len(id) == 2*apiKeyIdLength
+}
+
+func hashApiKeySecret(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+func randomBytes(length int) []byte {
+	value := make([]byte, length)
+	if _, e := rand.Read(value); e != nil {
+		panic(e)
+	}
+	return value
+}
+
+// create creates an api key for the role, which may not exceed the role of its creator
+func (aks *apiKeyStore) create(creator string, creatorRole domain.Role, request *domain.CreateApiKeyRequest) (*domain.CreatedApiKey, error) {
+	role, e := domain.ParseRole(request.Role)
+	if e != nil {
+		return nil, InvalidApiKeyRequestError.WithValues(e.Error())
+	} else if role > creatorRole {
+		return nil, InvalidApiKeyRequestError.WithValues("the role of an api key can't exceed the role of its creator")
+	} else if len(strings.TrimSpace(request.Name)) == 0 {
+		return nil, InvalidApiKeyRequestError.WithValues("a name is required")
+	}
+	days := request.ExpiresInDays
+	if days == 0 {
+		days = DefaultApiKeyExpiryDays
+	} else if days < 0 || days > MaxApiKeyExpiryDays {
+		return nil, InvalidApiKeyRequestError.WithValues("api keys expire within 1 to 365 days")
+	}
+
+	id := hex.EncodeToString(randomBytes(apiKeyIdLength))
+	secret := base64.RawURLEncoding.EncodeToString(randomBytes(32))
+	now := aks.now().UTC()
+	key := &storedApiKey{
+		ApiKey: domain.ApiKey{
+			Id:        id,
+			Name:      request.Name,
+			Role:      role.String(),
+			CreatedBy: creator,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Duration(days) * 24 * time.Hour),
+		},
+		Hash: hashApiKeySecret(secret),
+	}
+
+	var value map[string]any
+	content, _ := json.Marshal(key)
+	_ = json.Unmarshal(content, &value)
+	if _, e = aks.client.SetJsonByName(aks.prefix+id, value); e != nil {
+		return nil, e
+	}
+	return &domain.CreatedApiKey{ApiKey: key.ApiKey, Key: apiKeyPrefix + id + "_" + secret}, nil
+}
+
+// list returns all api keys, oldest first
+func (aks *apiKeyStore) list() ([]domain.ApiKey, error) {
+	credentials, e := aks.client.FindByPath(aks.prefix)
+	if e != nil {
+		return nil, e
+	}
+	keys := make([]domain.ApiKey, 0, len(credentials.Credentials))
+	for _, credential := range credentials.Credentials {
+		if key, e := aks.read(strings.TrimPrefix(credential.Name, aks.prefix)); e != nil {
+			l.Warningf("Unable to read api key %s : %v", credential.Name, e)
+		} else if key != nil {
+			keys = append(keys, key.ApiKey)
+		}
+	}
+	slices.SortFunc(keys, func(a, b domain.ApiKey) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return keys, nil
+}
+
+// revoke deletes the api key
+func (aks *apiKeyStore) revoke(id string) error {
+	if !validApiKeyId(id) {
+		return UnknownApiKeyError.WithValues(id)
+	}
+	defer aks.invalidate(id)
+	if key, e := aks.read(id); e != nil {
+		return e
+	} else if key == nil {
+		return UnknownApiKeyError.WithValues(id)
+	}
+	return aks.client.DeleteByName(aks.prefix + id)
+}
+
+// read reads the api key from credhub, nil if it doesn't exist
+func (aks *apiKeyStore) read(id string) (*storedApiKey, error) {
+	value, e := util.GetJsonIfExists(aks.client, aks.prefix+id)
+	if e != nil || value == nil {
+		return nil, e
+	}
+	key := &storedApiKey{}
+	content, _ := json.Marshal(value)
+	if e = json.Unmarshal(content, key); e != nil {
+		return nil, e
+	}
+	return key, nil
+}
+
+// lookup reads the api key through the cache, unknown keys being cached as well
+func (aks *apiKeyStore) lookup(id string) (*storedApiKey, error) {
+	aks.mutex.Lock()
+	cached := aks.cache[id]
+	aks.mutex.Unlock()
+	if cached != nil && cached.expires.After(aks.now()) {
+		return cached.key, nil
+	}
+
+	key, e := aks.read(id)
+	if e != nil {
+		return nil, e
+	}
+	aks.mutex.Lock()
+	defer aks.mutex.Unlock()
+	now := aks.now()
+	// drop expired entries from time to time
+	if now.Sub(aks.swept) > apiKeysCacheTtl {
+		for k, entry := range aks.cache {
+			if !entry.expires.After(now) {
+				delete(aks.cache, k)
+			}
+		}
+		aks.swept = now
+	}
+	// unknown ids are cached too, so unauthenticated callers can't have every attempt looked up in credhub, making room
+	// for them by dropping another unknown id when the cache is full
+	if len(aks.cache) >= apiKeysCacheMaxEntries {
+		for k, entry := range aks.cache {
+			if entry.key == nil {
+				delete(aks.cache, k)
+				break
+			}
+		}
+	}
+	if key != nil || len(aks.cache) < apiKeysCacheMaxEntries {
+		aks.cache[id] = &cachedApiKey{key: key, expires: now.Add(apiKeysCacheTtl)}
+	}
+	return key, nil
+}
+
+func (aks *apiKeyStore) invalidate(id string) {
+	aks.mutex.Lock()
+	delete(aks.cache, id)
+	aks.mutex.Unlock()
+}
+
+// authenticate returns the user of a valid, unexpired api key. Users get the scope of the api key role, mapping to
+// roles like uaa groups.
+func (aks *apiKeyStore) authenticate(apiKey string) (*security.User, error) {
+	id, secret, found := strings.Cut(strings.TrimPrefix(apiKey, apiKeyPrefix), "_")
+	if !found || !strings.HasPrefix(apiKey, apiKeyPrefix) || !validApiKeyId(id) {
+		return nil, InvalidApiKeyError
+	}
+
+	key, e := aks.lookup(id)
+	if e != nil {
+		return nil, e
+	} else if key == nil || subtle.ConstantTimeCompare([]byte(hashApiKeySecret(secret)), []byte(key.Hash)) != 1 {
+		return nil, InvalidApiKeyError
+	} else if !key.ExpiresAt.After(aks.now()) {
+		l.Warningf("[AUTH] Rejected expired api key %s (%s)", key.Name, key.Id)
+		return nil, InvalidApiKeyError
+	}
+
+	role, e := domain.ParseRole(key.Role)
+	if e != nil {
+		return nil, e
+	}
+	return &security.User{
+		Username: "apikey:" + key.Name,
+		Origin:   ApiKeyRealm,
+		OriginId: key.Id,
+		Scopes:   []string{roleScope(role)},
+		Active:   true,
+		Data:     &key.ApiKey,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
+	"github.com/gomatbase/go-we/security"
+	"github.com/gomatbase/go-we/util"
+	"github.com/rabobank/config-hub/audit"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const (
+	ApiKeyRealm    = "ApiKey"
+	apiKeyPrefix   = "chk_"
+	apiKeyIdLength = 8
+
+	DefaultApiKeyExpiryDays = 90
+	MaxApiKeyExpiryDays     = 365
+
+	// api keys are cached briefly to spare credhub, a revocation taking effect on other instances within the ttl.
+	// Unknown keys are only cached while the cache is below its maximum size, as anyone can make them up.
+	apiKeysCacheTtl        = 30 * time.Second
+	apiKeysCacheMaxEntries = 10000
+
+	InvalidApiKeyError        = csn.Error("invalid api key")
+	UnknownApiKeyError        = csn.ErrorF("unknown api key %s")
+	InvalidApiKeyRequestError = csn.ErrorF("invalid api key request : %s")
+)
+
+var apiKeys *apiKeyStore
+
+// apiKeyProvider authenticates requests with an Authorization: ApiKey <key> header
+type apiKeyProvider struct {
+	store *apiKeyStore
+}
+
+func (akp *apiKeyProvider) Authenticate(_ http.Header, scope we.RequestScope) (*security.User, error) {
+	authorization := scope.Request().Header.Get("Authorization")
+	if apiKey, found := strings.CutPrefix(authorization, ApiKeyRealm+" "); found {
+		if user, e := akp.store.authenticate(strings.TrimSpace(apiKey)); e != nil {
+			if e != InvalidApiKeyError {
+				l.Errorf("[AUTH] Unable to validate api key : %v", e)
+			}
+			return nil, events.UnauthorizedError
+		} else {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (akp *apiKeyProvider) Realm() string {
+	return ApiKeyRealm
+}
+
+func (akp *apiKeyProvider) IsValid(_ *security.User) bool {
+	return false
+}
+
+func (akp *apiKeyProvider) Challenge() string {
+	return ""
+}
+
+func (akp *apiKeyProvider) Endpoints() []string {
+	return nil
+}
+
+// managementAuthenticationProvider authenticates users of the management endpoints with an api key, when enabled, or
+// with a bearer token
+func managementAuthenticationProvider(bearerProvider security.AuthenticationProvider) security.AuthenticationProvider {
+	if len(cfg.ApiKeysPrefix) == 0 {
+		return bearerProvider
+	}
+	client, e := apiKeysClient()
+	if e != nil {
+		l.Critical(e)
+	}
+	apiKeys = newApiKeyStore(client, cfg.ApiKeysPrefix)
+	l.Infof("Api key authentication enabled with keys in %s", cfg.ApiKeysPrefix)
+	return firstOf{&apiKeyProvider{store: apiKeys}, bearerProvider}
+}
+
+func CreateApiKey(w we.ResponseWriter, scope we.RequestScope) error {
+	if apiKeys == nil {
+		return events.NotFoundError
+	}
+	user, _ := scope.Get(security.UserAttributeName).(*security.User)
+	if user.Origin == ApiKeyRealm {
+		// api keys can't extend their own lifetime
+		return events.ForbiddenError
+	}
+	if request, e := util.ReadJsonBody[domain.CreateApiKeyRequest](scope); e != nil {
+		return e
+	} else if created, e := apiKeys.create(user.Username, userRole(user, scope), request); e != nil {
+		if InvalidApiKeyRequestError.IsKindOf(e) {
+			return events.New(http.StatusBadRequest, e.Error())
+		}
+		return e
+	} else {
+		audit.Keys(scope, []string{created.Id})
+		return util.ReplyJson(w, http.StatusCreated, created)
+	}
+}
+
+func ListApiKeys(w we.ResponseWriter, _ we.RequestScope) error {
+	if apiKeys == nil {
+		return events.NotFoundError
+	}
+	if keys, e := apiKeys.list(); e != nil {
+		return e
+	} else {
+		return util.ReplyJson(w, http.StatusOK, keys)
+	}
+}
+
+func RevokeApiKey(w we.ResponseWriter, scope we.RequestScope) error {
+	if apiKeys == nil {
+		return events.NotFoundError
+	}
+	id := scope.Var("id")
+	audit.Keys(scope, []string{id})
+	if e := apiKeys.revoke(id); e != nil {
+		if UnknownApiKeyError.IsKindOf(e) {
+			return events.NotFoundError
+		}
+		return e
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/credhub-client"
+)
+
+type fakeCredhub struct {
+	credhub.Client
+	credentials map[string]map[string]any
+	finds       int
+}
+
+func (fc *fakeCredhub) GetJsonByName(name string) (map[string]any, error) {
+	if value, found := fc.credentials[name]; found {
+		return value, nil
+	}
+	return nil, errors.New("no data")
+}
+
+func (fc *fakeCredhub) SetJsonByName(name string, value map[string]any) (*credhub.Credential[map[string]any], error) {
+	fc.credentials[name] = value
+	return &credhub.Credential[map[string]any]{Name: name, Value: value}, nil
+}
+
+func (fc *fakeCredhub) DeleteByName(name string) error {
+	delete(fc.credentials, name)
+	return nil
+}
+
+func (fc *fakeCredhub) FindByName(name string) (*credhub.CredentialNames, error) {
+	fc.finds++
+	names := &credhub.CredentialNames{}
+	for credential := range fc.credentials {
+		if strings.Contains(credential, name) {
+			names.Credentials = append(names.Credentials, struct {
+				Name             string    `json:"name"`
+				VersionCreatedAt time.Time `json:"version_created_at"`
+			}{Name: credential})
+		}
+	}
+	return names, nil
+}
+
+func (fc *fakeCredhub) FindByPath(path string) (*credhub.CredentialNames, error) {
+	names := &credhub.CredentialNames{}
+	for name := range fc.credentials {
+		if strings.HasPrefix(name, path) {
+			names.Credentials = append(names.Credentials, struct {
+				Name             string    `json:"name"`
+				VersionCreatedAt time.Time `json:"version_created_at"`
+			}{Name: name})
+		}
+	}
+	return names, nil
+}
+
+func TestApiKeys(t *testing.T) {
+	cfg.ServiceInstanceId = "instance"
+	client := &fakeCredhub{credentials: make(map[string]map[string]any)}
+	store := newApiKeyStore(client, "/config-hub/api-keys")
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if _, e := store.create("alice", domain.EditorRole, &domain.CreateApiKeyRequest{Name: "pipeline", Role: "admin"}); !InvalidApiKeyRequestError.IsKindOf(e) {
+		t.Errorf("expected keys with a role above the creator role to be rejected, got %v", e)
+	}
+	if _, e := store.create("alice", domain.AdminRole, &domain.CreateApiKeyRequest{Name: "pipeline", Role: "editor", ExpiresInDays: 400}); !InvalidApiKeyRequestError.IsKindOf(e) {
+		t.Errorf("expected keys expiring beyond a year to be rejected, got %v", e)
+	}
+
+	created, e := store.create("alice", domain.AdminRole, &domain.CreateApiKeyRequest{Name: "pipeline", Role: "editor", ExpiresInDays: 30})
+	if e != nil {
+		t.Fatal(e)
+	}
+	stored := client.credentials["/config-hub/api-keys/"+created.Id]
+	if stored == nil || stored["hash"] == nil || strings.Contains(stored["hash"].(string), created.Key) {
+		t.Fatalf("expected the key to be stored hashed, got %v", stored)
+	}
+
+	user, e := store.authenticate(created.Key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if user.Username != "apikey:pipeline" || groupsRole(user.Scopes) != domain.EditorRole {
+		t.Errorf("expected an editor, got %+v", user)
+	}
+
+	for _, invalid := range []string{created.Key + "x", "chk_" + created.Id + "_other", "chk_../../x_y", "other"} {
+		if _, e = store.authenticate(invalid); e != InvalidApiKeyError {
+			t.Errorf("expected key %s to be rejected, got %v", invalid, e)
+		}
+	}
+
+	if keys, e := store.list(); e != nil || len(keys) != 1 || keys[0].Id != created.Id {
+		t.Errorf("expected the created key to be listed, got %v %v", keys, e)
+	}
+
+	now = now.Add(31 * 24 * time.Hour)
+	if _, e = store.authenticate(created.Key); e != InvalidApiKeyError {
+		t.Errorf("expected expired keys to be rejected")
+	}
+
+	if e = store.revoke(created.Id); e != nil {
+		t.Fatal(e)
+	}
+	if _, found := client.credentials["/config-hub/api-keys/"+created.Id]; found {
+		t.Errorf("expected the revoked key to be deleted")
+	}
+	if e = store.revoke(created.Id); !UnknownApiKeyError.IsKindOf(e) {
+		t.Errorf("expected unknown keys revocation to fail, got %v", e)
+	}
+}
+
+func TestApiKeysCacheBound(t *testing.T) {
+	store := newApiKeyStore(&fakeCredhub{credentials: make(map[string]map[string]any)}, "/config-hub/api-keys")
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	for i := 0; i < apiKeysCacheMaxEntries+10; i++ {
+		if _, e := store.authenticate(fmt.Sprintf("%s%016x_secret", apiKeyPrefix, i)); e != InvalidApiKeyError {
+			t.Fatalf("expected unknown keys to be rejected, got %v", e)
+		}
+	}
+	if len(store.cache) != apiKeysCacheMaxEntries {
+		t.Errorf("expected the cache to be bounded, got %d entries", len(store.cache))
+	}
+
+	// unknown ids keep being cached when the cache is full, only the first attempt reaching credhub
+	client := store.client.(*fakeCredhub)
+	finds := client.finds
+	for i := 0; i < 3; i++ {
+		_, _ = store.authenticate(apiKeyPrefix + "fffffffffffffffe_secret")
+	}
+	if client.finds != finds+1 || len(store.cache) != apiKeysCacheMaxEntries {
+		t.Errorf("expected a single credhub lookup of an unknown id, got %d in a cache of %d entries", client.finds-finds, len(store.cache))
+	}
+
+	now = now.Add(apiKeysCacheTtl + time.Second)
+	_, _ = store.authenticate(apiKeyPrefix + "ffffffffffffffff_secret")
+	if len(store.cache) != 1 {
+		t.Errorf("expected expired entries to be swept, got %d entries", len(store.cache))
+	}
+}
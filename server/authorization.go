@@ -3,11 +3,15 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
 	"github.com/gomatbase/go-we/security"
 	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
 	"github.com/rabobank/config-hub/util"
 )
 
@@ -64,38 +68,138 @@ type UaaUser struct {
 	Schemas              []string  `json:"schemas"`
 }
 
-func isDeveloper(user *security.User, scope we.RequestScope) bool {
-	if user == nil {
-		return false
-	}
-
+// cfRole returns the role the user gets from its cf permissions on the service instance. The permissions are cached per
+// user and token expiry, errors checking them are not cached.
+func cfRole(user *security.User, scope we.RequestScope) domain.Role {
 	bearerToken := scope.Request().Header.Get("Authorization")
-	if len(bearerToken) == 0 {
+	if len(bearerToken) < 7 || !strings.EqualFold(bearerToken[:7], "bearer ") {
 		// call is not authenticated with a bearer token, the user should have the token in the metadata
 		if token, isTokenData := user.Data.(*security.TokenData); !isTokenData {
 			// can't get a token to validate
-			return false
+			return domain.NoRole
 		} else {
 			bearerToken = "Bearer " + token.Raw
 		}
 	}
 
-	body, e := util.Request(fmt.Sprintf(PermissionsUrl, cfg.CfUrl, cfg.ServiceInstanceId)).WithAuthorization(bearerToken).Get()
+	expiry := tokenExpiry(user)
+	key := fmt.Sprintf("%s/%s@%d", user.OriginId, user.Username, expiry.Unix())
+	if role, found := cfRoles.get(key); found {
+		return role
+	}
+
+	permissions, e := servicePermissions(bearerToken)
 	if e != nil {
-		// log it
+		l.Errorf("[AUTH] Unable to check user %s permissions for service %s : %v", user.Username, cfg.ServiceInstanceId, e)
+		return domain.NoRole
+	}
+	role := domain.NoRole
+	if permissions.Manage {
+		role = cfg.CfManageRole
+	} else if permissions.Read {
+		role = domain.ViewerRole
 	} else {
-		var permissions CfServiceInstancePermissions
-		if e = json.Unmarshal(body, &permissions); e != nil {
-			fmt.Printf("Unable to check user %s permissions for service %s: %v\n", user.Username, cfg.ServiceInstanceId, e)
-		} else if permissions.Manage {
+		l.Warningf("[AUTH] User %s has no permissions on requested service %s", user.Username, cfg.ServiceInstanceId)
+	}
+	cfRoles.put(key, role, expiry)
+	return role
+}
+
+func servicePermissions(bearerToken string) (permissions *CfServiceInstancePermissions, e error) {
+	start := time.Now()
+	defer func() { permissionsLatency.Observe(start, e) }()
+
+	permissions = &CfServiceInstancePermissions{}
+	if body, e := util.Request(fmt.Sprintf(PermissionsUrl, cfg.CfUrl, cfg.ServiceInstanceId)).WithAuthorization(bearerToken).Get(); e != nil {
+		return nil, e
+	} else if e = json.Unmarshal(body, permissions); e != nil {
+		return nil, e
+	}
+	return permissions, nil
+}
+
+func readScope() string {
+	return "config_hub_" + cfg.ServiceInstanceId + ".read"
+}
+
+// hasReadAccess authorizes users holding the instance read scope or any app read scope, the apps actually read being
+// authorized by the handlers with authorizeApps
+func hasReadAccess(user *security.User, _ we.RequestScope) bool {
+	if user == nil {
+		return false
+	}
+	for _, scope := range user.Scopes {
+		if scope == readScope() || strings.HasPrefix(scope, readScope()+".") {
 			return true
-		} else {
-			fmt.Printf("[AUTH] User %s has no permissions to manage requested service %s\n", user.Username, cfg.ServiceInstanceId)
 		}
 	}
 	return false
 }
 
+// canRead checks if the scopes grant read access to the configuration of all apps. The shared application configuration
+// is readable by any reader of the instance.
+func canRead(scopes []string, apps []string, instanceWideRead bool) bool {
+	granted := make(map[string]bool)
+	for _, scope := range scopes {
+		if scope == readScope() {
+			if instanceWideRead {
+				return true
+			}
+		} else if app, isAppScope := strings.CutPrefix(scope, readScope()+"."); isAppScope {
+			granted[app] = true
+		}
+	}
+
+	for _, app := range apps {
+		if app = strings.TrimSpace(app); app != "application" && !granted[app] {
+			return false
+		}
+	}
+	return true
+}
+
+// authorizeApps fails with a forbidden error if the authenticated user can't read the configuration of all the apps
+func authorizeApps(scope we.RequestScope, apps string) error {
+	user, isUser := scope.Get(security.UserAttributeName).(*security.User)
+	if !isUser || !canRead(user.Scopes, strings.Split(apps, ","), cfg.InstanceWideRead) {
+		if isUser {
+			l.Warningf("[AUTH] User %s is not authorized to read the configuration of %s", user.Username, apps)
+		}
+		return events.ForbiddenError
+	}
+	return nil
+}
+
+func revealScope() string {
+	return "config_hub_" + cfg.ServiceInstanceId + ".reveal"
+}
+
+// canReveal checks if the user may read secret values. Apps, authenticated with client tokens or their instance identity,
+// read their secrets, while users need the reveal scope.
+func canReveal(user *security.User) bool {
+	if slices.Contains(user.Scopes, revealScope()) || user.Origin == InstanceIdentityRealm {
+		return true
+	}
+	if tokenData, isTokenData := user.Data.(*security.TokenData); isTokenData {
+		if tokenData.Claims != nil {
+			_, isUserToken := (*tokenData.Claims)["user_id"]
+			return !isUserToken
+		} else if tokenData.Introspection != nil {
+			return len(tokenData.Introspection.Username) == 0
+		}
+	}
+	return false
+}
+
+// masked checks if secret values must be masked in the response, because the caller can't reveal them or asks for it
+func masked(scope we.RequestScope) bool {
+	if scope.Parameter("masked") == "true" {
+		return true
+	}
+	user, isUser := scope.Get(security.UserAttributeName).(*security.User)
+	return !isUser || !canReveal(user)
+}
+
 func enrichUaaUser(user *security.User) (*security.User, error) {
 	uaaUser := new(UaaUser)
 	if tokenData, isType := user.Data.(*security.TokenData); !isType {
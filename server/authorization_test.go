@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/cfg"
+)
+
+func TestCanRead(t *testing.T) {
+	cfg.ServiceInstanceId = "instance"
+	scopes := []string{"openid", "config_hub_instance.read.payments", "config_hub_other.read.orders"}
+
+	for _, test := range []struct {
+		apps     []string
+		expected bool
+	}{
+		{[]string{"payments"}, true},
+		{[]string{"application"}, true},
+		{[]string{"payments", " application"}, true},
+		{[]string{"orders"}, false},
+		{[]string{"payments", "orders"}, false},
+		{[]string{"payments-eu"}, false},
+	} {
+		if canRead(scopes, test.apps, false) != test.expected {
+			t.Errorf("expected read access to %v to be %v", test.apps, test.expected)
+		}
+	}
+
+	wide := []string{"config_hub_instance.read"}
+	if canRead(wide, []string{"orders"}, false) {
+		t.Errorf("expected the instance read scope not to grant access to apps")
+	}
+	if !canRead(wide, []string{"orders"}, true) {
+		t.Errorf("expected the instance read scope to grant access to all apps when instance wide read is enabled")
+	}
+}
+
+func TestCanReveal(t *testing.T) {
+	cfg.ServiceInstanceId = "instance"
+	userClaims := jwt.MapClaims{"sub": "user-id", "user_id": "user-id"}
+	clientClaims := jwt.MapClaims{"sub": "app"}
+
+	for _, test := range []struct {
+		user     *security.User
+		expected bool
+	}{
+		{&security.User{Data: &security.TokenData{Claims: &userClaims}}, false},
+		{&security.User{Scopes: []string{"config_hub_instance.reveal"}, Data: &security.TokenData{Claims: &userClaims}}, true},
+		{&security.User{Data: &security.TokenData{Claims: &clientClaims}}, true},
+		{&security.User{Data: &security.TokenData{Introspection: &security.TokenIntrospection{Username: "user"}}}, false},
+		{&security.User{Data: &security.TokenData{Introspection: &security.TokenIntrospection{ClientId: "app"}}}, true},
+		{&security.User{Origin: InstanceIdentityRealm}, true},
+		{&security.User{}, false},
+	} {
+		if canReveal(test.user) != test.expected {
+			t.Errorf("expected reveal for %+v to be %v", test.user, test.expected)
+		}
+	}
+}
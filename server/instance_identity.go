@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/cfg"
+)
+
+const (
+	InstanceIdentityRealm     = "InstanceIdentity"
+	ForwardedClientCertHeader = "X-Forwarded-Client-Cert"
+
+	InvalidInstanceIdentityCaError = csn.Error("no valid certificates found in the instance identity CA")
+)
+
+// InstanceIdentity is the cf identity of an app instance, taken from the organizational units of its certificate
+type InstanceIdentity struct {
+	Instance     string
+	Organization string
+	Space        string
+	App          string
+}
+
+// instanceIdentityProvider authenticates apps with their cf instance identity certificate, either presented in the tls
+// handshake of the mutual tls listener or forwarded by a router sanitizing the forwarded certificate header. The
+// configuration the apps can read is derived from their organization, space and app guids.
+type instanceIdentityProvider struct {
+	roots          *x509.CertPool
+	apps           map[string][]string
+	trustForwarded bool
+}
+
+func InstanceIdentityProvider(caPem string, apps map[string][]string, trustForwarded bool) (security.AuthenticationProvider, error) {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(caPem)) {
+		return nil, InvalidInstanceIdentityCaError
+	}
+	return &instanceIdentityProvider{roots: roots, apps: apps, trustForwarded: trustForwarded}, nil
+}
+
+func (iip *instanceIdentityProvider) Authenticate(_ http.Header, scope we.RequestScope) (*security.User, error) {
+	return iip.authenticate(scope.Request())
+}
+
+func (iip *instanceIdentityProvider) authenticate(request *http.Request) (*security.User, error) {
+	var chain []*x509.Certificate
+	if request.TLS != nil {
+		// requests over the mutual tls listener come straight from the clients, the forwarded header isn't sanitized
+		if len(request.TLS.PeerCertificates) == 0 {
+			return nil, nil
+		}
+		chain = request.TLS.PeerCertificates
+	} else if forwarded := request.Header.Get(ForwardedClientCertHeader); iip.trustForwarded && len(forwarded) > 0 {
+		if certificate, e := parseForwardedCertificate(forwarded); e != nil {
+			l.Warningf("[AUTH] Unable to parse forwarded client certificate : %v", e)
+			return nil, events.UnauthorizedError
+		} else {
+			chain = []*x509.Certificate{certificate}
+		}
+	} else {
+		// no client certificate, let other providers authenticate the request
+		return nil, nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range chain[1:] {
+		intermediates.AddCert(certificate)
+	}
+	if _, e := chain[0].Verify(x509.VerifyOptions{
+		Roots:         iip.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); e != nil {
+		l.Warningf("[AUTH] Rejected instance identity certificate %s : %v", chain[0].Subject.CommonName, e)
+		return nil, events.UnauthorizedError
+	}
+
+	identity := instanceIdentity(chain[0])
+	if len(identity.App) == 0 {
+		l.Warningf("[AUTH] Certificate %s is not an instance identity certificate", chain[0].Subject.CommonName)
+		return nil, events.UnauthorizedError
+	}
+
+	user := &security.User{
+		Username: "app:" + identity.App,
+		Origin:   InstanceIdentityRealm,
+		OriginId: identity.Instance,
+		Active:   true,
+		Data:     identity,
+	}
+	for _, unit := range []string{"organization:" + identity.Organization, "space:" + identity.Space, "app:" + identity.App} {
+		for _, app := range iip.apps[unit] {
+			user.Scopes = append(user.Scopes, readScope()+"."+app)
+		}
+	}
+	return user, nil
+}
+
+func (iip *instanceIdentityProvider) Realm() string {
+	return InstanceIdentityRealm
+}
+
+func (iip *instanceIdentityProvider) IsValid(_ *security.User) bool {
+	// the certificate must be presented on every request
+	return false
+}
+
+func (iip *instanceIdentityProvider) Challenge() string {
+	return ""
+}
+
+func (iip *instanceIdentityProvider) Endpoints() []string {
+	return nil
+}
+
+func instanceIdentity(certificate *x509.Certificate) *InstanceIdentity {
+	identity := &InstanceIdentity{Instance: certificate.Subject.CommonName}
+	for _, unit := range certificate.Subject.OrganizationalUnit {
+		if guid, found := strings.CutPrefix(unit, "organization:"); found {
+			identity.Organization = guid
+		} else if guid, found = strings.CutPrefix(unit, "space:"); found {
+			identity.Space = guid
+		} else if guid, found = strings.CutPrefix(unit, "app:"); found {
+			identity.App = guid
+		}
+	}
+	return identity
+}
+
+// parseForwardedCertificate parses the client certificate forwarded by the router, either PEM (possibly url encoded)
+// or base64 encoded DER
+func parseForwardedCertificate(forwarded string) (*x509.Certificate, error) {
+	if unescaped, e := url.QueryUnescape(forwarded); e == nil && strings.Contains(unescaped, "-----BEGIN") {
+		forwarded = unescaped
+	}
+	if block, _ := pem.Decode([]byte(forwarded)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, e := base64.StdEncoding.DecodeString(forwarded)
+	if e != nil {
+		return nil, e
+	}
+	return x509.ParseCertificate(der)
+}
+
+// firstOf authenticates requests with the first provider finding credentials in the request, as path authentication
+// only consults the first provider
+type firstOf []security.AuthenticationProvider
+
+func (providers firstOf) Authenticate(headers http.Header, scope we.RequestScope) (*security.User, error) {
+	for _, provider := range providers {
+		if user, e := provider.Authenticate(headers, scope); e != nil || user != nil {
+			return user, e
+		}
+	}
+	return nil, nil
+}
+
+func (providers firstOf) Realm() string {
+	realms := make([]string, len(providers))
+	for i, provider := range providers {
+		realms[i] = provider.Realm()
+	}
+	return strings.Join(realms, "|")
+}
+
+func (providers firstOf) IsValid(_ *security.User) bool {
+	return false
+}
+
+func (providers firstOf) Challenge() string {
+	for _, provider := range providers {
+		if challenge := provider.Challenge(); len(challenge) > 0 {
+			return challenge
+		}
+	}
+	return ""
+}
+
+func (providers firstOf) Endpoints() []string {
+	return nil
+}
+
+// appAuthenticationProvider authenticates apps reading configuration with their instance identity certificate, when
+// configured, or with a bearer token
+func appAuthenticationProvider(bearerProvider security.AuthenticationProvider) security.AuthenticationProvider {
+	if len(cfg.InstanceIdentityCa) == 0 {
+		return bearerProvider
+	}
+	identityProvider, e := InstanceIdentityProvider(cfg.InstanceIdentityCa, cfg.InstanceIdentityApps, cfg.TrustForwardedClientCert)
+	if e != nil {
+		l.Critical(e)
+	}
+	l.Infof("Instance identity authentication enabled for %d organizations, spaces or apps", len(cfg.InstanceIdentityApps))
+	return firstOf{identityProvider, bearerProvider}
+}
+
+// mutualTlsConfig requests the clients for a certificate issued by the instance identity CA, reloading the server
+// certificate when it's about to expire, as instance identity certificates are short-lived
+func mutualTlsConfig(caPem, certificateFile, keyFile string) (*tls.Config, error) {
+	clientCas := x509.NewCertPool()
+	if !clientCas.AppendCertsFromPEM([]byte(caPem)) {
+		return nil, InvalidInstanceIdentityCaError
+	}
+
+	var certificate *tls.Certificate
+	var mutex sync.Mutex
+	load := func() (*tls.Certificate, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if certificate == nil || time.Now().Add(time.Minute).After(certificate.Leaf.NotAfter) {
+			loaded, e := tls.LoadX509KeyPair(certificateFile, keyFile)
+			if e != nil {
+				return nil, e
+			}
+			if loaded.Leaf, e = x509.ParseCertificate(loaded.Certificate[0]); e != nil {
+				return nil, e
+			}
+			certificate = &loaded
+		}
+		return certificate, nil
+	}
+	if _, e := load(); e != nil {
+		return nil, e
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  clientCas,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return load()
+		},
+	}, nil
+}
+
+// listenMutualTls serves the engine on the mutual tls port, if configured, for apps presenting their instance identity
+// certificate in the tls handshake
+func listenMutualTls(handler http.Handler) {
+	if len(cfg.MutualTlsPort) == 0 {
+		return
+	}
+	tlsConfig, e := mutualTlsConfig(cfg.InstanceIdentityCa, cfg.TlsCertificate, cfg.TlsKey)
+	if e != nil {
+		l.Critical(e)
+	}
+	server := &http.Server{Addr: ":" + cfg.MutualTlsPort, Handler: handler, TLSConfig: tlsConfig}
+	go func() {
+		l.Infof("Listening for mutual tls on %s", server.Addr)
+		l.Critical(server.ListenAndServeTLS("", ""))
+	}()
+}
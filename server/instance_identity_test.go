@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rabobank/config-hub/cfg"
+)
+
+func certificateAuthority(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "instance identity ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, e := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	return ca, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func issueCertificate(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, template *x509.Certificate) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template.SerialNumber = big.NewInt(2)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, e := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if e != nil {
+		t.Fatal(e)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: certificate}
+}
+
+func instanceKeyPair(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, units ...string) tls.Certificate {
+	return issueCertificate(t, ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "instance-guid", OrganizationalUnit: units},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func instanceCertificate(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, units ...string) *x509.Certificate {
+	return instanceKeyPair(t, ca, caKey, units...).Leaf
+}
+
+func TestInstanceIdentityProvider(t *testing.T) {
+	cfg.ServiceInstanceId = "instance"
+	ca, caKey, caPem := certificateAuthority(t)
+	provider, e := InstanceIdentityProvider(caPem, map[string][]string{
+		"app:app-guid":     {"payments"},
+		"space:space-guid": {"shared"},
+	}, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	iip := provider.(*instanceIdentityProvider)
+
+	certificate := instanceCertificate(t, ca, caKey, "organization:org-guid", "space:space-guid", "app:app-guid")
+	request := httptest.NewRequest(http.MethodGet, "/payments/default", nil)
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	user, e := iip.authenticate(request)
+	if e != nil || user == nil {
+		t.Fatalf("expected the instance to be authenticated : %v", e)
+	}
+	if user.Username != "app:app-guid" {
+		t.Errorf("unexpected username %s", user.Username)
+	}
+	for _, scope := range []string{"config_hub_instance.read.payments", "config_hub_instance.read.shared"} {
+		if !slices.Contains(user.Scopes, scope) {
+			t.Errorf("expected scope %s in %v", scope, user.Scopes)
+		}
+	}
+
+	// no certificate is left to the other providers
+	if user, e = iip.authenticate(httptest.NewRequest(http.MethodGet, "/payments/default", nil)); user != nil || e != nil {
+		t.Errorf("expected requests without certificate to be ignored")
+	}
+
+	// certificates from another ca are rejected
+	otherCa, otherKey, _ := certificateAuthority(t)
+	request.TLS.PeerCertificates = []*x509.Certificate{instanceCertificate(t, otherCa, otherKey, "app:app-guid")}
+	if user, e = iip.authenticate(request); user != nil || e == nil {
+		t.Errorf("expected certificates from another ca to be rejected")
+	}
+
+	// forwarded certificates are only trusted when configured
+	forwarded := httptest.NewRequest(http.MethodGet, "/payments/default", nil)
+	forwarded.Header.Set(ForwardedClientCertHeader, base64.StdEncoding.EncodeToString(certificate.Raw))
+	if user, _ = iip.authenticate(forwarded); user != nil {
+		t.Errorf("expected forwarded certificates not to be trusted")
+	}
+	iip.trustForwarded = true
+	if user, e = iip.authenticate(forwarded); e != nil || user == nil || user.Username != "app:app-guid" {
+		t.Errorf("expected the forwarded certificate to be trusted : %v", e)
+	}
+}
+
+func TestMutualTls(t *testing.T) {
+	cfg.ServiceInstanceId = "instance"
+	ca, caKey, caPem := certificateAuthority(t)
+	provider, _ := InstanceIdentityProvider(caPem, map[string][]string{"app:app-guid": {"payments"}}, true)
+	iip := provider.(*instanceIdentityProvider)
+
+	// the server certificate is read from files, like the container instance identity certificate
+	serverCertificate := issueCertificate(t, ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "config-hub"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	directory := t.TempDir()
+	certificateFile, keyFile := filepath.Join(directory, "instance.crt"), filepath.Join(directory, "instance.key")
+	keyDer, _ := x509.MarshalPKCS8PrivateKey(serverCertificate.PrivateKey)
+	_ = os.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCertificate.Certificate[0]}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	tlsConfig, e := mutualTlsConfig(caPem, certificateFile, keyFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	server := &http.Server{TLSConfig: tlsConfig, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, e := iip.authenticate(r); e != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if user == nil {
+			_, _ = w.Write([]byte("anonymous"))
+		} else {
+			_, _ = w.Write([]byte(user.Username))
+		}
+	})}
+	go func() { _ = server.ServeTLS(listener, "", "") }()
+	defer func() { _ = server.Close() }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	request := func(certificates ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}}
+		httpRequest, _ := http.NewRequest(http.MethodGet, "https://"+listener.Addr().String()+"/payments/default", nil)
+		// forwarded certificates sent straight to the mutual tls listener are never trusted
+		httpRequest.Header.Set(ForwardedClientCertHeader, base64.StdEncoding.EncodeToString(instanceCertificate(t, ca, caKey, "app:app-guid").Raw))
+		response, e := client.Do(httpRequest)
+		if e != nil {
+			return "", e
+		}
+		defer func() { _ = response.Body.Close() }()
+		body, _ := io.ReadAll(response.Body)
+		return string(body), nil
+	}
+
+	if body, e := request(instanceKeyPair(t, ca, caKey, "organization:org-guid", "space:space-guid", "app:app-guid")); e != nil || body != "app:app-guid" {
+		t.Errorf("expected the instance to be authenticated in the handshake, got %s %v", body, e)
+	}
+	if body, e := request(); e != nil || body != "anonymous" {
+		t.Errorf("expected requests without certificate to be left to other providers, got %s %v", body, e)
+	}
+	otherCa, otherKey, _ := certificateAuthority(t)
+	if _, e := request(instanceKeyPair(t, otherCa, otherKey, "app:app-guid")); e == nil {
+		t.Errorf("expected the handshake to fail for certificates from another ca")
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/util"
+)
+
+const (
+	OpenIdConfigurationPath = "/.well-known/openid-configuration"
+
+	// keys are reloaded at least every jwksMaxAge, so retired keys stop being accepted, and at most every
+	// jwksMinRefreshInterval when tokens are signed by unknown keys, so forged key ids can't hammer the openid server
+	jwksMaxAge             = time.Hour
+	jwksMinRefreshInterval = 30 * time.Second
+
+	NoJwksUrlError         = csn.Error("no jwks url provided nor advertised by the openid server")
+	UnknownSigningKeyError = csn.Error("token signed by an unknown key")
+	UnsupportedJwkError    = csn.ErrorF("unsupported json web key %s : %v")
+)
+
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+type jsonWebKeys struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jsonWebKey is a public RSA or EC json web key
+type jsonWebKey struct {
+	Id       string `json:"kid"`
+	Type     string `json:"kty"`
+	Use      string `json:"use"`
+	Modulus  string `json:"n"`
+	Exponent string `json:"e"`
+	Curve    string `json:"crv"`
+	X        string `json:"x"`
+	Y        string `json:"y"`
+}
+
+// jwtValidator validates bearer tokens locally, verifying their signature with the cached keys of the openid server and
+// checking their expiration, issuer and audience. Tokens which can't be validated locally are introspected by the
+// fallback introspector, if any.
+type jwtValidator struct {
+	jwksUrl   string
+	issuer    string
+	audiences []string
+	parser    *jwt.Parser
+	fallback  security.TokenIntrospector
+	timeout   time.Duration
+
+	keys      map[string]any
+	refreshed time.Time
+	attempted time.Time
+	mutex     sync.RWMutex
+	refresh   sync.Mutex
+	now       func() time.Time
+}
+
+// JwtValidator creates a local jwt validator for the given openid server. The issuer and jwks url are taken from the
+// openid configuration when not given. The fallback introspector is optional.
+func JwtValidator(openIdUrl, issuer, jwksUrl string, audiences []string, skew time.Duration, fallback security.TokenIntrospector) (security.TokenIntrospector, error) {
+	// the keys are fetched holding the refresh lock, an unresponsive openid server mustn't hold it for long
+	timeout := time.Duration(cfg.HttpTimeout) * time.Second
+	if len(issuer) == 0 || len(jwksUrl) == 0 {
+		var configuration security.OpenIdConfiguration
+		if e := util.Request(strings.TrimSuffix(openIdUrl, "/"), OpenIdConfigurationPath).WithTimeout(timeout).GetJson(&configuration); e != nil {
+			return nil, e
+		}
+		if len(issuer) == 0 {
+			issuer = configuration.Issuer
+		}
+		if len(jwksUrl) == 0 {
+			jwksUrl = configuration.JwksUri
+		}
+	}
+	if len(jwksUrl) == 0 {
+		return nil, NoJwksUrlError
+	}
+
+	validator := &jwtValidator{jwksUrl: jwksUrl, issuer: issuer, audiences: audiences, fallback: fallback, timeout: timeout, now: time.Now}
+	options := []jwt.ParserOption{jwt.WithValidMethods(jwtSigningMethods), jwt.WithLeeway(skew), jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return validator.now() })}
+	if len(issuer) > 0 {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if len(audiences) > 0 {
+		options = append(options, jwt.WithAudience(audiences...))
+	}
+	validator.parser = jwt.NewParser(options...)
+
+	if e := validator.refreshKeys(); e != nil {
+		// keys will be loaded with the first token
+		l.Warningf("[AUTH] Unable to load the openid server keys : %v", e)
+	}
+	return validator, nil
+}
+
+func (jv *jwtValidator) Introspect(token string) (*security.User, error) {
+	claims := jwt.MapClaims{}
+	if _, e := jv.parser.ParseWithClaims(token, &claims, jv.signingKey); e != nil {
+		if jv.fallback != nil && (errors.Is(e, jwt.ErrTokenMalformed) || errors.Is(e, UnknownSigningKeyError)) {
+			// opaque token or keys not available, let the openid server decide
+			return jv.fallback.Introspect(token)
+		}
+		l.Debugf("[AUTH] Rejected bearer token : %v", e)
+		return nil, e
+	}
+
+	user, e := security.DefaultClaimsMapper(&claims)
+	if e != nil {
+		return nil, e
+	}
+	if username, isString := claims["user_name"].(string); isString {
+		// same username as with token introspection
+		user.Username = username
+	}
+	user.Data = &security.TokenData{Raw: token, Claims: &claims}
+	return user, nil
+}
+
+func (jv *jwtValidator) signingKey(token *jwt.Token) (any, error) {
+	jv.mutex.RLock()
+	stale := jv.now().Sub(jv.refreshed) > jwksMaxAge
+	jv.mutex.RUnlock()
+	if stale {
+		if e := jv.refreshKeys(); e != nil {
+			l.Warningf("[AUTH] Unable to refresh the openid server keys, keeping the cached ones : %v", e)
+		}
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key := jv.key(kid); key != nil {
+		return key, nil
+	}
+
+	// keys may have been rotated
+	if e := jv.refreshKeys(); e != nil {
+		l.Warningf("[AUTH] Unable to refresh the openid server keys : %v", e)
+	}
+	if key := jv.key(kid); key != nil {
+		return key, nil
+	}
+	return nil, UnknownSigningKeyError
+}
+
+func (jv *jwtValidator) key(kid string) any {
+	jv.mutex.RLock()
+	defer jv.mutex.RUnlock()
+
+	if len(kid) == 0 && len(jv.keys) == 1 {
+		// tokens without key id can only be verified when a single key is published
+		for _, key := range jv.keys {
+			return key
+		}
+	}
+	return jv.keys[kid]
+}
+
+// refreshKeys reloads the keys of the openid server, at most once every jwksMinRefreshInterval
+func (jv *jwtValidator) refreshKeys() error {
+	jv.refresh.Lock()
+	defer jv.refresh.Unlock()
+
+	now := jv.now()
+	if !jv.attempted.IsZero() && now.Sub(jv.attempted) < jwksMinRefreshInterval {
+		return nil
+	}
+	jv.attempted = now
+
+	var jwks jsonWebKeys
+	if e := util.Request(jv.jwksUrl).WithTimeout(jv.timeout).GetJson(&jwks); e != nil {
+		return e
+	}
+	keys := make(map[string]any)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, e := jwk.publicKey(); e != nil {
+			l.Warningf("[AUTH] Ignoring openid server key : %v", e)
+		} else {
+			keys[jwk.Id] = key
+		}
+	}
+
+	jv.mutex.Lock()
+	jv.keys = keys
+	jv.refreshed = now
+	jv.mutex.Unlock()
+	return nil
+}
+
+func (jwk *jsonWebKey) publicKey() (any, error) {
+	switch jwk.Type {
+	case "RSA":
+		if modulus, e := base64.RawURLEncoding.DecodeString(jwk.Modulus); e != nil {
+			return nil, UnsupportedJwkError.WithValues(jwk.Id, e)
+		} else if exponent, e := base64.RawURLEncoding.DecodeString(jwk.Exponent); e != nil {
+			return nil, UnsupportedJwkError.WithValues(jwk.Id, e)
+		} else {
+			return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}, nil
+		}
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, UnsupportedJwkError.WithValues(jwk.Id, "curve "+jwk.Curve)
+		}
+		if x, e := base64.RawURLEncoding.DecodeString(jwk.X); e != nil {
+			return nil, UnsupportedJwkError.WithValues(jwk.Id, e)
+		} else if y, e := base64.RawURLEncoding.DecodeString(jwk.Y); e != nil {
+			return nil, UnsupportedJwkError.WithValues(jwk.Id, e)
+		} else {
+			return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+		}
+	default:
+		return nil, UnsupportedJwkError.WithValues(jwk.Id, "key type "+jwk.Type)
+	}
+}
+
+// tokenIntrospector returns the local jwt validator, falling back to the openid server introspection if configured, or
+// only the openid server introspection if local validation is disabled
+func tokenIntrospector(openIdProvider security.BearerAndSsoProvider) security.TokenIntrospector {
+	if !cfg.JwtLocalValidation {
+		return openIdProvider.TokenIntrospector()
+	}
+
+	var fallback security.TokenIntrospector
+	if cfg.JwtIntrospectionFallback {
+		fallback = openIdProvider.TokenIntrospector()
+	}
+	validator, e := JwtValidator(cfg.OpenIdUrl, cfg.JwtIssuer, cfg.JwksUrl, cfg.JwtAudiences, time.Duration(cfg.JwtClockSkew)*time.Second, fallback)
+	if e != nil {
+		if fallback == nil {
+			l.Critical(e)
+		}
+		l.Warningf("[AUTH] Local token validation unavailable, introspecting tokens : %v", e)
+		return fallback
+	}
+	return validator
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomatbase/go-we/security"
+)
+
+type signingKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+func (sk *signingKey) jwk() jsonWebKey {
+	return jsonWebKey{
+		Id:       sk.id,
+		Type:     "RSA",
+		Use:      "sig",
+		Modulus:  base64.RawURLEncoding.EncodeToString(sk.key.N.Bytes()),
+		Exponent: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(sk.key.E)).Bytes()),
+	}
+}
+
+func (sk *signingKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = sk.id
+	signed, e := token.SignedString(sk.key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return signed
+}
+
+func newSigningKey(t *testing.T, id string) *signingKey {
+	key, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return &signingKey{id: id, key: key}
+}
+
+type introspectorFunc func(token string) (*security.User, error)
+
+func (f introspectorFunc) Introspect(token string) (*security.User, error) {
+	return f(token)
+}
+
+func TestJwtValidator(t *testing.T) {
+	current := newSigningKey(t, "key-1")
+	published := []*signingKey{current}
+	jwksRequests := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case OpenIdConfigurationPath:
+			_ = json.NewEncoder(w).Encode(security.OpenIdConfiguration{Issuer: "https://uaa/oauth/token", JwksUri: server.URL + "/token_keys"})
+		case "/token_keys":
+			jwksRequests++
+			jwks := jsonWebKeys{}
+			for _, key := range published {
+				jwks.Keys = append(jwks.Keys, key.jwk())
+			}
+			_ = json.NewEncoder(w).Encode(jwks)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	introspected := 0
+	fallback := introspectorFunc(func(token string) (*security.User, error) {
+		introspected++
+		return &security.User{Username: "introspected"}, nil
+	})
+
+	introspector, e := JwtValidator(server.URL, "", "", []string{"config_hub"}, 30*time.Second, fallback)
+	if e != nil {
+		t.Fatal(e)
+	}
+	validator := introspector.(*jwtValidator)
+	now := time.Now()
+	validator.now = func() time.Time { return now }
+
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"sub":       "user-id",
+			"user_name": "user",
+			"iss":       "https://uaa/oauth/token",
+			"aud":       []string{"openid", "config_hub"},
+			"scope":     []string{"openid", "config_hub_instance.read"},
+			"exp":       now.Add(time.Minute).Unix(),
+		}
+		for key, value := range changes {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		user, e := validator.Introspect(current.sign(t, claims(nil)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if user.Username != "user" || user.OriginId != "user-id" || len(user.Scopes) != 2 {
+			t.Errorf("unexpected user %+v", user)
+		}
+		if data, isTokenData := user.Data.(*security.TokenData); !isTokenData || len(data.Raw) == 0 {
+			t.Errorf("expected the raw token to be kept with the user")
+		}
+	})
+
+	t.Run("expiration within clock skew", func(t *testing.T) {
+		if _, e := validator.Introspect(current.sign(t, claims(jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix()}))); e != nil {
+			t.Errorf("expected a token expired within the clock skew to be accepted : %v", e)
+		}
+		if _, e := validator.Introspect(current.sign(t, claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}))); e == nil {
+			t.Errorf("expected an expired token to be rejected")
+		}
+	})
+
+	t.Run("issuer and audience", func(t *testing.T) {
+		if _, e := validator.Introspect(current.sign(t, claims(jwt.MapClaims{"iss": "https://other/oauth/token"}))); e == nil {
+			t.Errorf("expected a token from another issuer to be rejected")
+		}
+		if _, e := validator.Introspect(current.sign(t, claims(jwt.MapClaims{"aud": []string{"openid"}}))); e == nil {
+			t.Errorf("expected a token for another audience to be rejected")
+		}
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		forged := &signingKey{id: current.id, key: newSigningKey(t, "forged").key}
+		if _, e := validator.Introspect(forged.sign(t, claims(nil))); e == nil {
+			t.Errorf("expected a token with an invalid signature to be rejected")
+		}
+		if introspected != 0 {
+			t.Errorf("expected invalid tokens not to be introspected")
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		rotated := newSigningKey(t, "key-2")
+		published = append(published, rotated)
+		now = now.Add(jwksMinRefreshInterval)
+		requests := jwksRequests
+		if _, e := validator.Introspect(rotated.sign(t, claims(nil))); e != nil {
+			t.Errorf("expected a token signed by a new key to be accepted : %v", e)
+		}
+		if jwksRequests != requests+1 {
+			t.Errorf("expected the keys to be refreshed once, got %d refreshes", jwksRequests-requests)
+		}
+
+		// unknown keys don't refresh the keys again within the refresh interval, tokens are left to the fallback
+		unknown := newSigningKey(t, "key-3")
+		if user, e := validator.Introspect(unknown.sign(t, claims(nil))); e != nil || user.Username != "introspected" {
+			t.Errorf("expected a token signed by an unknown key to be introspected")
+		}
+		if jwksRequests != requests+1 {
+			t.Errorf("expected the keys not to be refreshed again")
+		}
+
+		// retired keys are dropped when the keys are reloaded
+		published = []*signingKey{rotated}
+		now = now.Add(jwksMaxAge + time.Second)
+		introspected = 0
+		validator.fallback = nil
+		if _, e := validator.Introspect(current.sign(t, claims(jwt.MapClaims{"exp": now.Add(time.Minute).Unix()}))); e == nil {
+			t.Errorf("expected a token signed by a retired key to be rejected")
+		}
+		validator.fallback = fallback
+	})
+
+	t.Run("opaque tokens", func(t *testing.T) {
+		introspected = 0
+		if user, e := validator.Introspect("opaque-token"); e != nil || user.Username != "introspected" || introspected != 1 {
+			t.Errorf("expected opaque tokens to be introspected")
+		}
+		validator.fallback = nil
+		if _, e := validator.Introspect("opaque-token"); e == nil {
+			t.Errorf("expected opaque tokens to be rejected without fallback")
+		}
+	})
+}
+
+func TestJwksTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer server.Close()
+	defer close(release)
+
+	validator := &jwtValidator{jwksUrl: server.URL + "/token_keys", timeout: 100 * time.Millisecond, now: time.Now}
+	start := time.Now()
+	if e := validator.refreshKeys(); e == nil {
+		t.Errorf("expected the keys refresh from an unresponsive openid server to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the keys refresh to time out after %v, took %v", validator.timeout, elapsed)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/metrics"
+)
+
+const (
+	// granted roles are cached longer than denied ones, so users granted access don't wait long for it
+	permissionsCacheTtl         = time.Minute
+	permissionsNegativeCacheTtl = 10 * time.Second
+)
+
+var (
+	cfApiMetrics       = metrics.Group("cf_api")
+	permissionsLatency = metrics.NewLatency(cfApiMetrics, "permissions")
+	permissionsMetrics = metrics.Group("permissions_cache")
+
+	cfRoles = newPermissionsCache(permissionsCacheTtl, permissionsNegativeCacheTtl)
+)
+
+type cachedPermission struct {
+	role    domain.Role
+	expires time.Time
+}
+
+// permissionsCache caches the role users get from their service instance permissions, keyed by user and token expiry so a new token
+// triggers a new check. Entries never outlive the token they were checked with.
+type permissionsCache struct {
+	ttl         time.Duration
+	negativeTtl time.Duration
+	entries     map[string]*cachedPermission
+	swept       time.Time
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+func newPermissionsCache(ttl, negativeTtl time.Duration) *permissionsCache {
+	return &permissionsCache{ttl: ttl, negativeTtl: negativeTtl, entries: make(map[string]*cachedPermission), now: time.Now}
+}
+
+func (pc *permissionsCache) get(key string) (role domain.Role, found bool) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if entry := pc.entries[key]; entry != nil && entry.expires.After(pc.now()) {
+		permissionsMetrics.Add("hits", 1)
+		return entry.role, true
+	}
+	permissionsMetrics.Add("misses", 1)
+	return domain.NoRole, false
+}
+
+func (pc *permissionsCache) put(key string, role domain.Role, tokenExpiry time.Time) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	now := pc.now()
+	expires := now.Add(pc.negativeTtl)
+	if role != domain.NoRole {
+		expires = now.Add(pc.ttl)
+	}
+	if !tokenExpiry.IsZero() && tokenExpiry.Before(expires) {
+		expires = tokenExpiry
+	}
+	pc.entries[key] = &cachedPermission{role: role, expires: expires}
+
+	// drop expired entries from time to time
+	if now.Sub(pc.swept) > pc.ttl {
+		for k, entry := range pc.entries {
+			if !entry.expires.After(now) {
+				delete(pc.entries, k)
+			}
+		}
+		pc.swept = now
+	}
+}
+
+// tokenExpiry returns the expiry of the token the user authenticated with, if known
+func tokenExpiry(user *security.User) time.Time {
+	if tokenData, isTokenData := user.Data.(*security.TokenData); isTokenData {
+		if tokenData.Claims != nil {
+			if expiry, e := tokenData.Claims.GetExpirationTime(); e == nil && expiry != nil {
+				return expiry.Time
+			}
+		} else if tokenData.Introspection != nil && tokenData.Introspection.Expiration > 0 {
+			return time.Unix(tokenData.Introspection.Expiration, 0)
+		}
+	}
+	return time.Time{}
+}
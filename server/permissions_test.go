@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestPermissionsCache(t *testing.T) {
+	cache := newPermissionsCache(time.Minute, 10*time.Second)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.put("granted", domain.EditorRole, time.Time{})
+	cache.put("denied", domain.NoRole, time.Time{})
+	cache.put("expiring", domain.ViewerRole, now.Add(5*time.Second))
+
+	if role, found := cache.get("granted"); !found || role != domain.EditorRole {
+		t.Errorf("expected granted permissions to be cached")
+	}
+	if role, found := cache.get("denied"); !found || role != domain.NoRole {
+		t.Errorf("expected denied permissions to be cached")
+	}
+	if _, found := cache.get("unknown"); found {
+		t.Errorf("expected unknown users not to be cached")
+	}
+
+	now = now.Add(6 * time.Second)
+	if _, found := cache.get("expiring"); found {
+		t.Errorf("expected permissions not to outlive the token")
+	}
+
+	now = now.Add(5 * time.Second)
+	if _, found := cache.get("denied"); found {
+		t.Errorf("expected denied permissions to expire with the negative ttl")
+	}
+	if _, found := cache.get("granted"); !found {
+		t.Errorf("expected granted permissions to be cached longer")
+	}
+
+	now = now.Add(time.Minute)
+	if _, found := cache.get("granted"); found {
+		t.Errorf("expected granted permissions to expire")
+	}
+	cache.put("other", domain.ViewerRole, time.Time{})
+	if len(cache.entries) != 1 {
+		t.Errorf("expected expired entries to be dropped, got %d entries", len(cache.entries))
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/audit"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/metrics"
+)
+
+const (
+	ReadsRateLimit  = "reads"
+	WritesRateLimit = "writes"
+	CacheRateLimit  = "cache"
+
+	// idle buckets are refilled, so they are dropped instead of being kept for every client ever seen
+	rateLimitSweepInterval = time.Minute
+)
+
+var rateLimitMetrics = metrics.Group("rate_limits")
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps a token bucket per client for a group of routes
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	swept   time.Time
+	mutex   sync.Mutex
+	now     func() time.Time
+
+	allowed  expvar.Int
+	rejected expvar.Int
+}
+
+func newRateLimiter(group string, limit domain.RateLimit) *rateLimiter {
+	limiter := &rateLimiter{rate: limit.Rate, burst: float64(limit.Burst), buckets: make(map[string]*tokenBucket), now: time.Now}
+	limiter.swept = limiter.now()
+
+	groupMetrics := new(expvar.Map)
+	rate, burst := new(expvar.Float), new(expvar.Int)
+	rate.Set(limit.Rate)
+	burst.Set(int64(limit.Burst))
+	groupMetrics.Set("rate", rate)
+	groupMetrics.Set("burst", burst)
+	groupMetrics.Set("allowed", &limiter.allowed)
+	groupMetrics.Set("rejected", &limiter.rejected)
+	groupMetrics.Set("clients", expvar.Func(func() any {
+		limiter.mutex.Lock()
+		defer limiter.mutex.Unlock()
+		return len(limiter.buckets)
+	}))
+	rateLimitMetrics.Set(group, groupMetrics)
+	return limiter
+}
+
+// allow takes a token from the client bucket, returning how long to wait for the next token when it's empty
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	if rl.rate <= 0 {
+		return true, 0
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.swept) > rateLimitSweepInterval {
+		rl.sweep(now)
+	}
+
+	bucket := rl.buckets[client]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: rl.burst, updated: now}
+		rl.buckets[client] = bucket
+	} else {
+		bucket.tokens = math.Min(rl.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*rl.rate)
+		bucket.updated = now
+	}
+
+	if bucket.tokens < 1 {
+		rl.rejected.Add(1)
+		return false, time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	rl.allowed.Add(1)
+	return true, 0
+}
+
+func (rl *rateLimiter) sweep(now time.Time) {
+	for client, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, client)
+		}
+	}
+	rl.swept = now
+}
+
+// rateLimitedClient identifies the client of a request: apps presenting their instance identity by their app guid, api
+// keys and tokens by their id and subject, wherever they're called from, and anonymous requests by their address
+func rateLimitedClient(user *security.User, request *http.Request) string {
+	if user != nil {
+		switch {
+		case user.Origin == InstanceIdentityRealm:
+			return user.Username
+		case user.Origin == ApiKeyRealm:
+			return "apikey:" + user.OriginId
+		case len(user.OriginId) > 0:
+			return "sub:" + user.OriginId
+		case len(user.Username) > 0:
+			return "user:" + user.Username
+		}
+	}
+	return "ip:" + audit.ClientIp(request)
+}
+
+// limited rejects the requests of clients exceeding the limit with a 429, telling them when to retry
+func (rl *rateLimiter) limited(handler we.HandlerFunction) we.HandlerFunction {
+	return func(w we.ResponseWriter, scope we.RequestScope) error {
+		user, _ := scope.Get(security.UserAttributeName).(*security.User)
+		client := rateLimitedClient(user, scope.Request())
+		if allowed, retryAfter := rl.allow(client); !allowed {
+			l.Warningf("Rate limit exceeded by %s on %s %s", client, scope.Request().Method, scope.Request().URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return events.New(http.StatusTooManyRequests, "rate limit exceeded")
+		}
+		return handler(w, scope)
+	}
+}
+
+// rateLimiters creates the limiters of the route groups, groups without configured limit being unlimited
+func rateLimiters() map[string]*rateLimiter {
+	limiters := make(map[string]*rateLimiter)
+	for _, group := range []string{ReadsRateLimit, WritesRateLimit, CacheRateLimit} {
+		limit := cfg.RateLimits[group]
+		limiters[group] = newRateLimiter(group, limit)
+		if limit.Rate > 0 {
+			l.Infof("Rate limiting %s to %v requests per second per client, bursting to %d", group, limit.Rate, limit.Burst)
+		}
+	}
+	return limiters
+}
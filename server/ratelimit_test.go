@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(t.Name(), domain.RateLimit{Rate: 0.5, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow("app:1"); !allowed {
+			t.Fatalf("expected request %d within the burst to be allowed", i+1)
+		}
+	}
+	if allowed, retryAfter := limiter.allow("app:1"); allowed || retryAfter != 2*time.Second {
+		t.Errorf("expected the request to be rejected until the next token in 2s, got %v and %v", allowed, retryAfter)
+	}
+	if allowed, _ := limiter.allow("app:2"); !allowed {
+		t.Errorf("expected other clients not to be limited")
+	}
+
+	now = now.Add(time.Second)
+	if allowed, retryAfter := limiter.allow("app:1"); allowed || retryAfter != time.Second {
+		t.Errorf("expected the request to be rejected until the next token in 1s, got %v and %v", allowed, retryAfter)
+	}
+	now = now.Add(time.Second)
+	if allowed, _ := limiter.allow("app:1"); !allowed {
+		t.Errorf("expected the request to be allowed once the bucket is refilled")
+	}
+	if limiter.allowed.Value() != 4 || limiter.rejected.Value() != 2 {
+		t.Errorf("unexpected metrics, %d allowed and %d rejected", limiter.allowed.Value(), limiter.rejected.Value())
+	}
+
+	// refilled buckets are dropped
+	now = now.Add(rateLimitSweepInterval + time.Second)
+	limiter.allow("app:3")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("expected idle buckets to be swept, %d buckets left", len(limiter.buckets))
+	}
+
+	unlimited := newRateLimiter(t.Name()+"-unlimited", domain.RateLimit{})
+	for i := 0; i < 100; i++ {
+		if allowed, _ := unlimited.allow("app:1"); !allowed {
+			t.Fatalf("expected groups without rate to be unlimited")
+		}
+	}
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	request := func(address string) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "/payments/default", nil)
+		request.Header.Set("X-Forwarded-For", "10.0.0.1, "+address)
+		return request
+	}
+	instance := func(app, guid string) *security.User {
+		return &security.User{Username: "app:" + app, Origin: InstanceIdentityRealm, OriginId: guid}
+	}
+	client := &security.User{Username: "payments-client", Origin: "uaa", OriginId: "payments-client"}
+	apiKey := &security.User{Username: "pipeline", Origin: ApiKeyRealm, OriginId: "key-id"}
+
+	for _, shared := range [][2]string{
+		{rateLimitedClient(instance("payments-guid", "instance-1"), request("10.1.0.1")), rateLimitedClient(instance("payments-guid", "instance-2"), request("10.1.0.2"))},
+		{rateLimitedClient(client, request("10.1.0.1")), rateLimitedClient(client, request("10.1.0.2"))},
+		{rateLimitedClient(apiKey, request("10.1.0.1")), rateLimitedClient(apiKey, request("10.1.0.2"))},
+	} {
+		if shared[0] != shared[1] {
+			t.Errorf("expected %s and %s to share a bucket", shared[0], shared[1])
+		}
+	}
+	for _, different := range [][2]string{
+		{rateLimitedClient(instance("payments-guid", "instance-1"), request("10.1.0.1")), rateLimitedClient(instance("orders-guid", "instance-1"), request("10.1.0.1"))},
+		{rateLimitedClient(nil, request("10.1.0.1")), rateLimitedClient(nil, request("10.1.0.2"))},
+	} {
+		if different[0] == different[1] {
+			t.Errorf("expected clients not to share the bucket %s", different[0])
+		}
+	}
+}
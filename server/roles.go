@@ -0,0 +1,76 @@
+package server
+
+import (
+	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/audit"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const CloudControllerAdminScope = "cloud_controller.admin"
+
+func roleScope(role domain.Role) string {
+	return "config_hub_" + cfg.ServiceInstanceId + "." + role.String()
+}
+
+// groupsRole returns the highest role granted by the user scopes, cf admins being secrets admins
+func groupsRole(scopes []string) domain.Role {
+	role := domain.NoRole
+	for _, scope := range scopes {
+		if scope == CloudControllerAdminScope {
+			return domain.AdminRole
+		}
+		for candidate := domain.ViewerRole; candidate <= domain.AdminRole; candidate++ {
+			if scope == roleScope(candidate) && candidate > role {
+				role = candidate
+			}
+		}
+	}
+	return role
+}
+
+// userRole returns the effective role of the user, the highest of the roles granted by the uaa groups and the cf
+// permissions on the service instance. The role is kept in the request scope.
+func userRole(user *security.User, scope we.RequestScope) domain.Role {
+	if role, found := scope.Get(domain.RoleAttributeName).(domain.Role); found {
+		return role
+	}
+	role := domain.NoRole
+	if user != nil {
+		if role = groupsRole(user.Scopes); role < domain.AdminRole {
+			role = max(role, cfRole(user, scope))
+		}
+	}
+	scope.Set(domain.RoleAttributeName, role)
+	return role
+}
+
+// hasRole authorizes users with at least the given role
+func hasRole(role domain.Role) security.Authorization {
+	return security.AuthorizationFunc(func(user *security.User, scope we.RequestScope) bool {
+		return userRole(user, scope) >= role
+	})
+}
+
+// requireRole only lets users with at least the given role through to the handler
+func requireRole(role domain.Role, handler we.HandlerFunction) we.HandlerFunction {
+	return func(w we.ResponseWriter, scope we.RequestScope) error {
+		user, _ := scope.Get(security.UserAttributeName).(*security.User)
+		if effective := userRole(user, scope); effective < role {
+			if user != nil {
+				l.Warningf("[AUTH] User %s with role %s requires role %s for %s %s", user.Username, effective, role,
+					scope.Request().Method, scope.Request().URL.Path)
+			}
+			return events.ForbiddenError
+		}
+		return handler(w, scope)
+	}
+}
+
+// audited rate limits and requires the role for a mutating call, recording every attempt in the audit log, including
+// the ones denied by the limiter
+func audited(limited func(we.HandlerFunction) we.HandlerFunction, role domain.Role, action string, handler we.HandlerFunction) we.HandlerFunction {
+	return audit.Audited(action, limited(requireRole(role, handler)))
+}
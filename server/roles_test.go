@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestGroupsRole(t *testing.T) {
+	cfg.ServiceInstanceId = "instance"
+
+	for _, test := range []struct {
+		scopes   []string
+		expected domain.Role
+	}{
+		{nil, domain.NoRole},
+		{[]string{"openid", "config_hub_instance.read"}, domain.NoRole},
+		{[]string{"config_hub_instance.viewer"}, domain.ViewerRole},
+		{[]string{"config_hub_instance.viewer", "config_hub_instance.editor"}, domain.EditorRole},
+		{[]string{"config_hub_instance.admin", "config_hub_instance.viewer"}, domain.AdminRole},
+		{[]string{"config_hub_other.admin"}, domain.NoRole},
+		{[]string{"openid", CloudControllerAdminScope}, domain.AdminRole},
+	} {
+		if role := groupsRole(test.scopes); role != test.expected {
+			t.Errorf("expected role %s for %v, got %s", test.expected, test.scopes, role)
+		}
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/gomatbase/go-we/events"
 	"github.com/gomatbase/go-we/security"
 	"github.com/gomatbase/go-we/util"
+	"github.com/rabobank/config-hub/audit"
 	"github.com/rabobank/config-hub/cfg"
 	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/metrics"
 	"github.com/rabobank/config-hub/sources"
 	"github.com/rabobank/config-hub/sources/credhub_source"
 	"github.com/rabobank/config-hub/sources/git_source"
@@ -26,10 +28,18 @@ func Server() {
 		l.Critical(e)
 	}
 
+	if cfg.InstanceWideRead {
+		l.Warningf("[AUTH] The %s scope grants read access to all apps. INSTANCE_WIDE_READ=true is deprecated, grant apps their %s.<app> scopes and remove it", readScope(), readScope())
+	}
+
 	if e := sources.Setup(); e != nil {
 		l.Critical(e)
 	}
 
+	if e := audit.Setup(); e != nil {
+		l.Critical(e)
+	}
+
 	l.Infof("OpenId Url: %s\n", cfg.OpenIdUrl)
 	openIdProvider := security.OpenIdIdentityProvider(cfg.OpenIdUrl).
 		Client(cfg.Client, cfg.Secret).Scope("cloud_controller.read", "openid").
@@ -38,45 +48,85 @@ func Server() {
 	ssoAuthenticationProvider := security.SSOAuthenticationProvider().DefaultAuthenticatedEndpoint("/dashboard").
 		AuthorizationCodeProvider(openIdProvider.AuthorizationCodeProvider()).Build()
 	bearerAuthenticationProvider := security.BearerAuthenticationProvider().
-		Introspector(openIdProvider.TokenIntrospector()).Build()
+		Introspector(tokenIntrospector(openIdProvider)).Build()
 
-	allowedUsers := security.Either(security.Scope("cloud_controller.admin"), security.AuthorizationFunc(isDeveloper))
+	// any role may reach the secrets management endpoints, each endpoint requiring its own role
+	allowedUsers := hasRole(domain.ViewerRole)
+	managementProvider := managementAuthenticationProvider(bearerAuthenticationProvider)
 
 	securityFilter := security.Filter(true).
 		Path("/health", "/info").Anonymous().
 		Path("/credentials").Authorize(security.AuthorizationFunc(localhost)).
-		Path("/secrets", "/secrets/add", "/secrets/delete", "/secrets/list", "/cache").Authentication(bearerAuthenticationProvider).Authorize(allowedUsers).
+		Path("/secrets", "/secrets/**", "/cache", "/metrics", "/audit", "/apikeys", "/apikeys/**").Authentication(managementProvider).Authorize(allowedUsers).
 		Path("/dashboard").Authentication(ssoAuthenticationProvider).Authorize(allowedUsers).
-		Path("/**").Authentication(bearerAuthenticationProvider).Authorize(security.Scope("config_hub_" + cfg.ServiceInstanceId + ".read")).
+		Path("/**").Authentication(appAuthenticationProvider(bearerAuthenticationProvider)).Authorize(security.AuthorizationFunc(hasReadAccess)).
 		Build()
 
+	limiters := rateLimiters()
+	reads, writes, cache := limiters[ReadsRateLimit].limited, limiters[WritesRateLimit].limited, limiters[CacheRateLimit].limited
+
 	engine := we.New()
 	engine.AddFilter(securityFilter)
 
 	// git credentials helper
 	engine.HandleMethod("POST", "/credentials", git_source.ServeCredentials)
 
-	// credentials management endpoints
-	engine.HandleMethod("POST", "/secrets/add", credhub_source.AddSecrets)
-	engine.HandleMethod("POST", "/secrets", credhub_source.AddSecrets)
-	engine.HandleMethod("DELETE", "/secrets/delete", credhub_source.DeleteSecrets)
-	engine.HandleMethod("DELETE", "/secrets", credhub_source.DeleteSecrets)
-	engine.HandleMethod("GET", "/secrets/list", credhub_source.ListSecretsCompatible)
-	engine.HandleMethod("GET", "/secrets", credhub_source.ListSecrets)
+	// credentials management endpoints, targeting the first credhub source
+	engine.HandleMethod("POST", "/secrets/add", audited(writes, domain.EditorRole, "secrets.add", credhub_source.AddSecrets))
+	engine.HandleMethod("POST", "/secrets", audited(writes, domain.EditorRole, "secrets.add", credhub_source.AddSecrets))
+	engine.HandleMethod("DELETE", "/secrets/delete", audited(writes, domain.AdminRole, "secrets.delete", credhub_source.DeleteSecrets))
+	engine.HandleMethod("DELETE", "/secrets", audited(writes, domain.AdminRole, "secrets.delete", credhub_source.DeleteSecrets))
+	engine.HandleMethod("GET", "/secrets/list", requireRole(domain.ViewerRole, credhub_source.ListSecretsCompatible))
+	engine.HandleMethod("GET", "/secrets", requireRole(domain.ViewerRole, credhub_source.ListSecrets))
+	engine.HandleMethod("GET", "/secrets/history", requireRole(domain.ViewerRole, credhub_source.SecretsHistory))
+	engine.HandleMethod("POST", "/secrets/rollback", audited(writes, domain.AdminRole, "secrets.rollback", credhub_source.RollbackSecrets))
+	engine.HandleMethod("POST", "/secrets/export", audited(writes, domain.AdminRole, "secrets.export", credhub_source.ExportSecrets))
+	engine.HandleMethod("POST", "/secrets/import", audited(writes, domain.AdminRole, "secrets.import", credhub_source.ImportSecrets))
+	engine.HandleMethod("POST", "/secrets/copy", audited(writes, domain.EditorRole, "secrets.copy", credhub_source.CopySecrets))
+	engine.HandleMethod("POST", "/secrets/rotate", audited(writes, domain.EditorRole, "secrets.rotate", credhub_source.RotateSecrets))
+	engine.HandleMethod("GET", "/secrets/expiring", requireRole(domain.ViewerRole, credhub_source.ExpiringSecrets))
+
+	// credentials management endpoints for a named credhub source, under their own segment so source names never shadow
+	// the endpoints of the default source
+	engine.HandleMethod("POST", "/secrets/sources/{source}/add", audited(writes, domain.EditorRole, "secrets.add", credhub_source.AddSecrets))
+	engine.HandleMethod("POST", "/secrets/sources/{source}", audited(writes, domain.EditorRole, "secrets.add", credhub_source.AddSecrets))
+	engine.HandleMethod("DELETE", "/secrets/sources/{source}/delete", audited(writes, domain.AdminRole, "secrets.delete", credhub_source.DeleteSecrets))
+	engine.HandleMethod("DELETE", "/secrets/sources/{source}", audited(writes, domain.AdminRole, "secrets.delete", credhub_source.DeleteSecrets))
+	engine.HandleMethod("GET", "/secrets/sources/{source}/list", requireRole(domain.ViewerRole, credhub_source.ListSecretsCompatible))
+	engine.HandleMethod("GET", "/secrets/sources/{source}", requireRole(domain.ViewerRole, credhub_source.ListSecrets))
+	engine.HandleMethod("GET", "/secrets/sources/{source}/history", requireRole(domain.ViewerRole, credhub_source.SecretsHistory))
+	engine.HandleMethod("POST", "/secrets/sources/{source}/rollback", audited(writes, domain.AdminRole, "secrets.rollback", credhub_source.RollbackSecrets))
+	engine.HandleMethod("POST", "/secrets/sources/{source}/export", audited(writes, domain.AdminRole, "secrets.export", credhub_source.ExportSecrets))
+	engine.HandleMethod("POST", "/secrets/sources/{source}/import", audited(writes, domain.AdminRole, "secrets.import", credhub_source.ImportSecrets))
+	engine.HandleMethod("POST", "/secrets/sources/{source}/copy", audited(writes, domain.EditorRole, "secrets.copy", credhub_source.CopySecrets))
+	engine.HandleMethod("POST", "/secrets/sources/{source}/rotate", audited(writes, domain.EditorRole, "secrets.rotate", credhub_source.RotateSecrets))
+	engine.HandleMethod("GET", "/secrets/sources/{source}/expiring", requireRole(domain.ViewerRole, credhub_source.ExpiringSecrets))
 
 	// Cache endpoints
-	engine.HandleMethod("DELETE", "/cache", deleteCache)
+	engine.HandleMethod("DELETE", "/cache", audited(cache, domain.EditorRole, "cache.delete", deleteCache))
+
+	// api keys
+	engine.HandleMethod("POST", "/apikeys", audited(writes, domain.AdminRole, "apikeys.create", CreateApiKey))
+	engine.HandleMethod("GET", "/apikeys", requireRole(domain.AdminRole, ListApiKeys))
+	engine.HandleMethod("DELETE", "/apikeys/{id}", audited(writes, domain.AdminRole, "apikeys.revoke", RevokeApiKey))
+
+	// audit log
+	engine.HandleMethod("GET", "/audit", requireRole(domain.AdminRole, audit.Handler))
+
+	// metrics
+	engine.HandleMethod("GET", "/metrics", metrics.Handler)
 
 	// dashboard
 	engine.HandleMethod("GET", "/dashboard", sources.Dashboard)
 
 	// config-server compatible endpoints
-	engine.HandleMethod("GET", "/{app}/{profiles}", findProperties) // will also take care of /{label}/{app}-{profiles}.(json|properties|yml|yaml)
-	engine.HandleMethod("GET", "/{app}/{profiles}/{label}", findProperties)
+	engine.HandleMethod("GET", "/{app}/{profiles}", reads(findProperties)) // will also take care of /{label}/{app}-{profiles}.(json|properties|yml|yaml)
+	engine.HandleMethod("GET", "/{app}/{profiles}/{label}", reads(findProperties))
 
 	// config-server alternative format endpoints
-	engine.HandleMethod("GET", "/{appProfiles}", findFormattedProperties)
+	engine.HandleMethod("GET", "/{appProfiles}", reads(findFormattedProperties))
 
+	listenMutualTls(engine.Handler())
 	l.Critical(engine.Listen(":" + cfg.Port))
 }
 
@@ -93,21 +143,19 @@ func deleteCache(w we.ResponseWriter, _ we.RequestScope) error {
 
 func findProperties(w we.ResponseWriter, scope we.RequestScope) error {
 	app := scope.Var("app")
-	var profiles []string
-
-	// revert order of profiles returned to follow config-server logic... so... first priority requested should be last one served
-	for _, profile := range strings.Split(scope.Var("profiles"), ",") {
-		profiles = append([]string{profile}, profiles...)
+	if e := authorizeApps(scope, app); e != nil {
+		return e
 	}
+	profiles := strings.Split(scope.Var("profiles"), ",")
 
 	label := scope.Var("label")
 	label = strings.ReplaceAll(label, "(_)", "/")
 
 	l.Debugf("Received properties request for app: %s, profiles: %v and label: %s", app, profiles, label)
-	if properties := sources.FindProperties(app, profiles, label); properties != nil {
+	if properties := sources.FindProperties(app, profiles, label, masked(scope)); properties != nil {
 		response := &domain.Configs{
 			App:      app,
-			Profiles: strings.Split(scope.Var("profiles"), ","),
+			Profiles: profiles,
 			Sources:  properties,
 			Label:    &label,
 		}
@@ -155,7 +203,10 @@ func findFormattedProperties(w we.ResponseWriter, scope we.RequestScope) error {
 	} else {
 		profiles := app[dashIndex+1:]
 		app = app[:dashIndex]
-		if properties := sources.FindPropertiesMap(app, strings.Split(profiles, ","), ""); properties != nil {
+		if e := authorizeApps(scope, app); e != nil {
+			return e
+		}
+		if properties := sources.FindPropertiesMap(app, strings.Split(profiles, ","), "", masked(scope)); properties != nil {
 			if e := replyFunction(w, http.StatusOK, properties); e != nil {
 				l.Errorf("Error when replying in %s to properties request: %v", suffix, e)
 			}
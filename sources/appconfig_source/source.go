@@ -0,0 +1,330 @@
+package appconfig_source
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-log"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/azure"
+	"github.com/rabobank/config-hub/sources/spi"
+	"github.com/rabobank/config-hub/util"
+)
+
+const (
+	InvalidConfigurationObjectError = csn.Error("expected an app configuration configuration object")
+
+	ApiVersion         = "1.0"
+	KeyVaultApiVersion = "7.4"
+	KeyValuesEndpoint  = "%s/kv?%s"
+	NullLabel          = "\x00"
+
+	FeatureFlagPrefix            = ".appconfig.featureflag/"
+	FeatureManagementPrefix      = "feature-management"
+	FeatureFlagContentType       = "application/vnd.microsoft.appconfig.ff+json"
+	KeyVaultReferenceContentType = "application/vnd.microsoft.appconfig.keyvaultref+json"
+	KeyVaultHostSuffix           = ".vault.azure.net"
+
+	UntrustedKeyVaultReferenceError = csn.ErrorF("untrusted key vault reference %s")
+)
+
+var l, _ = log.GetWithOptions("APPCONFIG_SOURCE", log.Standard().WithFailingCriticals().WithLogPrefix(log.Name, log.LogLevel, log.Separator).WithStartingLevel(cfg.LogLevel))
+
+type keyValue struct {
+	Key         string  `json:"key"`
+	Label       *string `json:"label"`
+	Value       string  `json:"value"`
+	ContentType string  `json:"content_type"`
+}
+
+type keyValues struct {
+	Items    []keyValue `json:"items"`
+	NextLink *string    `json:"@nextLink"`
+}
+
+type keyVaultReference struct {
+	Uri string `json:"uri"`
+}
+
+type featureFlag struct {
+	Id         string `json:"id"`
+	Enabled    bool   `json:"enabled"`
+	Conditions struct {
+		ClientFilters []struct {
+			Name       string         `json:"name"`
+			Parameters map[string]any `json:"parameters,omitempty"`
+		} `json:"client_filters"`
+	} `json:"conditions"`
+}
+
+type cachedKeyValues struct {
+	items      []keyValue
+	expiration time.Time
+}
+
+type cachedSecret struct {
+	value      string
+	expiration time.Time
+}
+
+type source struct {
+	endpoint            string
+	profileSeparator    string
+	nullLabel           string
+	cacheTtl            time.Duration
+	keyVaultHosts       []string
+	credentials         azure.Credentials
+	keyVaultCredentials azure.Credentials
+
+	// key-values cached by key filter and label, and resolved key vault references by secret url
+	cache   map[string]*cachedKeyValues
+	secrets map[string]*cachedSecret
+
+	lock sync.Mutex
+}
+
+func (s *source) String() string {
+	return fmt.Sprintf("AppConfigurationSource{endpoint:%s, profileSeparator:%s, nullLabel:%s, ttl:%v}", s.endpoint, s.profileSeparator, s.nullLabel, s.cacheTtl)
+}
+
+func (s *source) Name() string {
+	return s.endpoint
+}
+
+func (s *source) DashboardReport() *string {
+	return nil
+}
+
+func (s *source) ClearCache() {
+	l.Debugf("Clearing cache for app configuration source %s", s.endpoint)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cache = make(map[string]*cachedKeyValues)
+	s.secrets = make(map[string]*cachedSecret)
+}
+
+func (s *source) FindProperties(apps []string, profiles []string, requestedLabel string) ([]*domain.PropertySource, error) {
+	l.Debugf("Finding properties from app configuration %s for app(s):%v, profiles:%s and label %s", s.endpoint, apps, profiles, requestedLabel)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !util.HasApplication(apps) {
+		apps = append(apps, "application")
+	}
+
+	// the requested label takes precedence over the key-values with no label
+	labels := []string{NullLabel}
+	label := s.nullLabel
+	if len(requestedLabel) != 0 && requestedLabel != s.nullLabel {
+		labels = []string{requestedLabel, NullLabel}
+		label = requestedLabel
+	}
+
+	var result []*domain.PropertySource
+	for _, app := range apps {
+		for _, profile := range profiles {
+			if profile == "default" {
+				continue
+			}
+			if propertySource, e := s.properties(fmt.Sprintf("appconfig-%s-%s-%s", app, profile, label), "/"+app+s.profileSeparator+profile+"/", labels); e != nil {
+				return nil, e
+			} else if propertySource != nil {
+				result = append(result, propertySource)
+			}
+		}
+		if propertySource, e := s.properties(fmt.Sprintf("appconfig-%s-%s", app, label), "/"+app+"/", labels); e != nil {
+			return nil, e
+		} else if propertySource != nil {
+			result = append(result, propertySource)
+		}
+	}
+
+	if propertySource, e := s.properties(fmt.Sprintf("appconfig-%s-%s", FeatureManagementPrefix, label), FeatureFlagPrefix, labels); e != nil {
+		return nil, e
+	} else if propertySource != nil {
+		result = append(result, propertySource)
+	}
+
+	return result, nil
+}
+
+// properties merges the key-values under the given prefix for all given labels, the first label having precedence.
+// Keys resolved from key vault references are reported as secret keys.
+func (s *source) properties(name, prefix string, labels []string) (*domain.PropertySource, error) {
+	var result map[string]any
+	secrets := make(map[string]bool)
+	for i := len(labels) - 1; i >= 0; i-- {
+		items, e := s.keyValues(prefix, labels[i])
+		if e != nil {
+			return nil, e
+		}
+		for _, item := range items {
+			if result == nil {
+				result = make(map[string]any)
+			}
+			if e = s.addProperty(result, secrets, prefix, item); e != nil {
+				l.Errorf("Unable to resolve key %s : %v", item.Key, e)
+			}
+		}
+	}
+	if result == nil {
+		return nil, nil
+	}
+
+	propertySource := &domain.PropertySource{Source: name, Properties: result}
+	for key, secret := range secrets {
+		if secret {
+			propertySource.SecretKeys = append(propertySource.SecretKeys, key)
+		}
+	}
+	return propertySource, nil
+}
+
+func (s *source) addProperty(properties map[string]any, secrets map[string]bool, prefix string, item keyValue) error {
+	key := strings.TrimPrefix(item.Key, prefix)
+	contentType, _, _ := strings.Cut(item.ContentType, ";")
+	switch contentType {
+	case KeyVaultReferenceContentType:
+		reference := &keyVaultReference{}
+		if e := json.Unmarshal([]byte(item.Value), reference); e != nil {
+			return e
+		} else if value, e := s.resolve(reference.Uri); e != nil {
+			return e
+		} else {
+			properties[key] = value
+			secrets[key] = true
+		}
+	case FeatureFlagContentType:
+		flag := &featureFlag{}
+		if e := json.Unmarshal([]byte(item.Value), flag); e != nil {
+			return e
+		}
+		name := FeatureManagementPrefix + "." + flag.Id
+		if !flag.Enabled || len(flag.Conditions.ClientFilters) == 0 {
+			properties[name] = flag.Enabled
+		} else {
+			filters := make([]any, len(flag.Conditions.ClientFilters))
+			for i, filter := range flag.Conditions.ClientFilters {
+				filters[i] = map[string]any{"name": filter.Name, "parameters": filter.Parameters}
+			}
+			properties[name] = map[string]any{"enabled-for": filters}
+		}
+	default:
+		// a plain value of a label with precedence replaces a reference
+		properties[key] = item.Value
+		secrets[key] = false
+	}
+	return nil
+}
+
+func (s *source) keyValues(prefix, label string) ([]keyValue, error) {
+	cacheKey := prefix + "|" + label
+	if cached, found := s.cache[cacheKey]; found && time.Now().Before(cached.expiration) {
+		return cached.items, nil
+	}
+
+	token, e := s.credentials.Token()
+	if e != nil {
+		return nil, e
+	}
+
+	query := url.Values{"key": {prefix + "*"}, "label": {label}, "api-version": {ApiVersion}}
+	var items []keyValue
+	for next := fmt.Sprintf(KeyValuesEndpoint, s.endpoint, query.Encode()); len(next) != 0; {
+		page := &keyValues{}
+		if e = util.Request(next).WithBearerToken(token).Accepting("application/vnd.microsoft.appconfig.kvset+json").GetJson(page); e != nil {
+			l.Errorf("Failed to read key-values %s of %s : %v", prefix, s.endpoint, e)
+			return nil, e
+		}
+		items = append(items, page.Items...)
+		// next links are relative to the endpoint
+		next = ""
+		if page.NextLink != nil {
+			next = s.endpoint + *page.NextLink
+		}
+	}
+
+	s.cache[cacheKey] = &cachedKeyValues{items: items, expiration: time.Now().Add(s.cacheTtl)}
+	return items, nil
+}
+
+// secretUrl validates a key vault reference, only sending the key vault token to trusted hosts, and returns the url of
+// the referenced secret
+func (s *source) secretUrl(secretUri string) (string, error) {
+	uri, e := url.Parse(secretUri)
+	if e != nil || uri.Scheme != "https" || len(uri.Host) == 0 || uri.User != nil {
+		return "", UntrustedKeyVaultReferenceError.WithValues(secretUri)
+	}
+	if !strings.HasSuffix(strings.ToLower(uri.Hostname()), KeyVaultHostSuffix) && !slices.Contains(s.keyVaultHosts, uri.Host) {
+		return "", UntrustedKeyVaultReferenceError.WithValues(secretUri)
+	}
+
+	// secrets are referenced as /secrets/<name> or /secrets/<name>/<version>
+	segments := strings.Split(strings.Trim(uri.Path, "/"), "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[0] != "secrets" || slices.Contains(segments, "") || slices.Contains(segments, "..") {
+		return "", UntrustedKeyVaultReferenceError.WithValues(secretUri)
+	}
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return "https://" + uri.Host + "/" + strings.Join(segments, "/") + "?api-version=" + KeyVaultApiVersion, nil
+}
+
+// resolve reads the value of a key vault secret referenced by a key-value, cached like the key-values
+func (s *source) resolve(secretUri string) (string, error) {
+	secretUrl, e := s.secretUrl(secretUri)
+	if e != nil {
+		return "", e
+	}
+	if cached, found := s.secrets[secretUrl]; found && time.Now().Before(cached.expiration) {
+		return cached.value, nil
+	}
+
+	token, e := s.keyVaultCredentials.Token()
+	if e != nil {
+		return "", e
+	}
+
+	secret := &struct {
+		Value string `json:"value"`
+	}{}
+	if e = util.Request(secretUrl).WithBearerToken(token).GetJson(secret); e != nil {
+		return "", e
+	}
+	s.secrets[secretUrl] = &cachedSecret{value: secret.Value, expiration: time.Now().Add(s.cacheTtl)}
+	return secret.Value, nil
+}
+
+func newSource(config *domain.AppConfigurationConfig, credentials, keyVaultCredentials azure.Credentials) *source {
+	return &source{
+		endpoint:            config.Endpoint,
+		profileSeparator:    config.ProfileSeparator,
+		nullLabel:           config.NullLabel,
+		cacheTtl:            time.Duration(config.CacheTtl) * time.Second,
+		keyVaultHosts:       config.KeyVaultHosts,
+		credentials:         credentials,
+		keyVaultCredentials: keyVaultCredentials,
+		cache:               make(map[string]*cachedKeyValues),
+		secrets:             make(map[string]*cachedSecret),
+	}
+}
+
+func Source(sourceConfig domain.SourceConfig) (spi.Source, error) {
+	if config, isType := sourceConfig.(*domain.AppConfigurationConfig); !isType {
+		return nil, InvalidConfigurationObjectError
+	} else if credentials, e := azure.FromConfig(&config.AzureConfig, config.Username, config.Password, azure.AppConfigurationScope); e != nil {
+		return nil, e
+	} else if keyVaultCredentials, e := azure.FromConfig(&config.AzureConfig, config.Username, config.Password, azure.KeyVaultScope); e != nil {
+		return nil, e
+	} else {
+		return newSource(config, credentials, keyVaultCredentials), nil
+	}
+}
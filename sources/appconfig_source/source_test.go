@@ -0,0 +1,137 @@
+package appconfig_source
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+type staticToken string
+
+func (st staticToken) Token() (string, error) {
+	return string(st), nil
+}
+
+// appConfigurationStandIn serves key-values filtered by key prefix and label, as well as a key vault secret
+type appConfigurationStandIn struct {
+	url           string
+	items         []map[string]any
+	vaultRequests int
+}
+
+func (ac *appConfigurationStandIn) item(key, label, value, contentType string) {
+	item := map[string]any{"key": key, "value": value, "content_type": contentType}
+	if len(label) != 0 {
+		item["label"] = label
+	}
+	ac.items = append(ac.items, item)
+}
+
+func (ac *appConfigurationStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/secrets/db-password" && r.Header.Get("Authorization") == "Bearer vault-token":
+		ac.vaultRequests++
+		_ = json.NewEncoder(w).Encode(map[string]any{"value": "from-vault"})
+	case r.URL.Path == "/kv" && r.Header.Get("Authorization") == "Bearer appconfig-token":
+		prefix := strings.TrimSuffix(r.URL.Query().Get("key"), "*")
+		label := r.URL.Query().Get("label")
+		var items []map[string]any
+		for _, item := range ac.items {
+			itemLabel, hasLabel := item["label"]
+			if strings.HasPrefix(item["key"].(string), prefix) && (hasLabel && itemLabel == label || !hasLabel && label == NullLabel) {
+				items = append(items, item)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+	default:
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func TestFindProperties(t *testing.T) {
+	standIn := &appConfigurationStandIn{}
+	server := httptest.NewTLSServer(standIn)
+	defer server.Close()
+	// key vault references must be https, trust the stand-in certificate
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = defaultTransport }()
+
+	standIn.item("/payments/greeting", "", "hello", "")
+	standIn.item("/payments/greeting", "release-1", "hello from release", "")
+	standIn.item("/payments_prod/spring.datasource.password", "", `{"uri":"`+server.URL+`/secrets/db-password"}`, KeyVaultReferenceContentType+";charset=utf-8")
+	standIn.item("/application/shared", "", "shared", "")
+	standIn.item(FeatureFlagPrefix+"beta", "", `{"id":"beta","enabled":true,"conditions":{"client_filters":[]}}`, FeatureFlagContentType+";charset=utf-8")
+
+	config := &domain.AppConfigurationConfig{}
+	if e := config.FromMap(map[string]any{"type": "appconfig", "endpoint": server.URL, "keyVaultHosts": []any{strings.TrimPrefix(server.URL, "https://")},
+		"azTenantId": "tenant", "azClient": "client", "azSecret": "secret"}); e != nil {
+		t.Fatal(e)
+	}
+	s := newSource(config, staticToken("appconfig-token"), staticToken("vault-token"))
+
+	sources, e := s.FindProperties([]string{"payments"}, []string{"prod"}, "release-1")
+	if e != nil {
+		t.Fatal(e)
+	}
+	found := make(map[string]map[string]any)
+	secretKeys := make(map[string][]string)
+	for _, source := range sources {
+		found[source.Source] = source.Properties
+		secretKeys[source.Source] = source.SecretKeys
+	}
+
+	if v := found["appconfig-payments-prod-release-1"]["spring.datasource.password"]; v != "from-vault" {
+		t.Errorf("Expected key vault reference to be resolved, got %v", v)
+	}
+	if keys := secretKeys["appconfig-payments-prod-release-1"]; len(keys) != 1 || keys[0] != "spring.datasource.password" {
+		t.Errorf("Expected the resolved key vault reference to be reported as secret, got %v", keys)
+	}
+	if keys := secretKeys["appconfig-payments-release-1"]; len(keys) != 0 {
+		t.Errorf("Expected plain values not to be reported as secrets, got %v", keys)
+	}
+	if v := found["appconfig-payments-release-1"]["greeting"]; v != "hello from release" {
+		t.Errorf("Expected the requested label to take precedence, got %v", v)
+	}
+	if v := found["appconfig-application-release-1"]["shared"]; v != "shared" {
+		t.Errorf("Expected unlabeled shared key-values, got %v", v)
+	}
+	if v := found["appconfig-feature-management-release-1"]["feature-management.beta"]; v != true {
+		t.Errorf("Expected feature flag beta to be enabled, got %v", v)
+	}
+
+	// resolved references are cached
+	_, _ = s.FindProperties([]string{"payments"}, []string{"prod"}, "release-1")
+	if standIn.vaultRequests != 1 {
+		t.Errorf("Expected the key vault secret to be read once, got %d reads", standIn.vaultRequests)
+	}
+
+	sources, _ = s.FindProperties([]string{"payments"}, []string{"default"}, "")
+	if sources[0].Source != "appconfig-payments-master" || sources[0].Properties["greeting"] != "hello" {
+		t.Errorf("Expected the null label to be served for master, got %v", sources[0])
+	}
+}
+
+func TestSecretUrl(t *testing.T) {
+	s := &source{keyVaultHosts: []string{"vault.internal:8443"}}
+	for uri, expected := range map[string]string{
+		"https://my-vault.vault.azure.net/secrets/db-password":          "https://my-vault.vault.azure.net/secrets/db-password?api-version=" + KeyVaultApiVersion,
+		"https://my-vault.vault.azure.net/secrets/db-password/v1?x=y#z": "https://my-vault.vault.azure.net/secrets/db-password/v1?api-version=" + KeyVaultApiVersion,
+		"https://vault.internal:8443/secrets/db-password":               "https://vault.internal:8443/secrets/db-password?api-version=" + KeyVaultApiVersion,
+		"http://my-vault.vault.azure.net/secrets/db-password":           "",
+		"https://attacker.example.com/secrets/db-password":              "",
+		"https://vault.azure.net.attacker.example.com/secrets/a":        "",
+		"https://user@my-vault.vault.azure.net/secrets/db-password":     "",
+		"https://my-vault.vault.azure.net/keys/db-password":             "",
+		"https://my-vault.vault.azure.net/secrets/../keys/a":            "",
+		"https://vault.internal/secrets/db-password":                    "",
+	} {
+		if secretUrl, e := s.secretUrl(uri); secretUrl != expected || (len(expected) == 0) != UntrustedKeyVaultReferenceError.IsKindOf(e) {
+			t.Errorf("Unexpected url %s for reference %s (%v)", secretUrl, uri, e)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package azure
+
+import (
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+)
+
+// Token scopes of the azure resources accessed by config-hub
+const (
+	DevOpsScope           = "499b84ac-1321-427f-aa17-267ca6975798/.default"
+	KeyVaultScope         = "https://vault.azure.net/.default"
+	AppConfigurationScope = "https://azconfig.io/.default"
+)
+
+const NoAzureCredentialsError = csn.Error("no az spn nor az mi configuration provided")
+
+// Credentials provides access tokens for an azure identity, either an app registration (SPN) or a managed identity
+// federated with a workload identity (MI WIF)
+type Credentials interface {
+	Token() (string, error)
+}
+
+// FromConfig creates the credentials for the identity described in the azure configuration. The username and password
+// are the credentials of the workload identity issuer, only relevant for MI WIF identities.
+func FromConfig(config *domain.AzureConfig, username, password *string, scope string) (Credentials, error) {
+	if config.AzMi {
+		return NewMiWifCredentials(*config.AzTenantId, *config.AzMiId, *config.AzMiWifIssuer, *config.AzMiWifClient, *config.AzMiWifSecret, *username, *password, scope)
+	} else if config.AzSpn {
+		return NewSpnCredentials(*config.AzTenantId, *config.AzClient, config.AzSecret, config.AzSecretCredhubClient, config.AzSecretCredhubSecret, config.AzSecretCredhubReference, scope)
+	}
+	return nil, NoAzureCredentialsError
+}
@@ -1,4 +1,4 @@
-package git_source
+package azure
 
 import (
 	"context"
@@ -16,6 +16,7 @@ import (
 type miWifCredentials struct {
 	tenantId    string
 	name        string
+	scope       string
 	tokenSource oauth2.TokenSource
 	cachedToken azcore.AccessToken
 
@@ -31,7 +32,7 @@ func (mwc *miWifCredentials) getFederatedToken(_ context.Context) (string, error
 	}
 }
 
-func (mwc *miWifCredentials) token() (string, error) {
+func (mwc *miWifCredentials) Token() (string, error) {
 	mwc.mutex.Lock()
 	defer mwc.mutex.Unlock()
 
@@ -42,7 +43,7 @@ func (mwc *miWifCredentials) token() (string, error) {
 	if credential, e := azidentity.NewClientAssertionCredential(mwc.tenantId, mwc.name, mwc.getFederatedToken, nil); e != nil {
 		return "", e
 	} else if token, e := credential.GetToken(context.Background(), policy.TokenRequestOptions{
-		Scopes: []string{"499b84ac-1321-427f-aa17-267ca6975798/.default"}}); e != nil {
+		Scopes: []string{mwc.scope}}); e != nil {
 		return "", e
 	} else {
 		mwc.cachedToken = token
@@ -51,7 +52,7 @@ func (mwc *miWifCredentials) token() (string, error) {
 	return mwc.cachedToken.Token, nil
 }
 
-func newMiWifCredentials(tenantId, miName, tokenIssuer, clientId, secret, user, password string) (*miWifCredentials, error) {
+func NewMiWifCredentials(tenantId, miName, tokenIssuer, clientId, secret, user, password, scope string) (Credentials, error) {
 	uaaCredentials := &passwordcredentials.Config{
 		ClientID:     clientId,
 		ClientSecret: secret,
@@ -65,11 +66,12 @@ func newMiWifCredentials(tenantId, miName, tokenIssuer, clientId, secret, user,
 	result := &miWifCredentials{
 		tenantId:    tenantId,
 		name:        miName,
+		scope:       scope,
 		tokenSource: tokenSource,
 	}
 
 	// get a token to test it
-	if _, e := result.token(); e != nil {
+	if _, e := result.Token(); e != nil {
 		return nil, e
 	}
 
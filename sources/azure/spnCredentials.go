@@ -1,9 +1,7 @@
-package git_source
+package azure
 
 import (
 	"context"
-	"encoding/json"
-	"os"
 	"sync"
 	"time"
 
@@ -14,9 +12,13 @@ import (
 	"github.com/rabobank/credhub-client"
 )
 
+// newCredhubClient creates the credhub client reading the spn secret, authenticated with the given uaa client and secret
+var newCredhubClient = util.CredhubClient
+
 type spnCredentials struct {
 	tenantId         string
 	clientId         string
+	scope            string
 	cachedSecret     string
 	secretExpiration time.Time
 	cachedToken      azcore.AccessToken
@@ -25,7 +27,8 @@ type spnCredentials struct {
 	credhubClient credhub.Client
 	credhubRef    *string
 
-	mutex sync.Mutex
+	mutex      sync.Mutex
+	tokenMutex sync.Mutex
 }
 
 func (spnc *spnCredentials) secret() (string, error) {
@@ -43,14 +46,16 @@ func (spnc *spnCredentials) secret() (string, error) {
 	if credential, e := spnc.credhubClient.GetJsonCredentialByName(*spnc.credhubRef); e != nil {
 		return "", e
 	} else {
-		json.NewEncoder(os.Stdout).Encode(credential)
 		spnc.cachedSecret = credential.Value["secret"].(string)
 		spnc.secretExpiration = credential.VersionCreatedAt.Add(time.Hour * 24)
 	}
 	return spnc.cachedSecret, nil
 }
 
-func (spnc *spnCredentials) token() (string, error) {
+func (spnc *spnCredentials) Token() (string, error) {
+	spnc.tokenMutex.Lock()
+	defer spnc.tokenMutex.Unlock()
+
 	if spnc.cachedToken.ExpiresOn.After(time.Now().Add(10 * time.Second)) {
 		return spnc.cachedToken.Token, nil
 	}
@@ -61,7 +66,7 @@ func (spnc *spnCredentials) token() (string, error) {
 		// JV: maybe handle one retry, in case of 401, to handle racing conditions
 		return "", e
 	} else if token, e := credential.GetToken(context.Background(), policy.TokenRequestOptions{
-		Scopes: []string{"499b84ac-1321-427f-aa17-267ca6975798/.default"}}); e != nil {
+		Scopes: []string{spnc.scope}}); e != nil {
 		return "", e
 	} else {
 		spnc.cachedToken = token
@@ -69,14 +74,18 @@ func (spnc *spnCredentials) token() (string, error) {
 	return spnc.cachedToken.Token, nil
 }
 
-func newSpnCredentials(tenantId, clientId string, secret, credhubClient, credhubSecret, credhubReference *string) (result *spnCredentials, e error) {
-	result = &spnCredentials{
+func NewSpnCredentials(tenantId, clientId string, secret, credhubClient, credhubSecret, credhubReference *string, scope string) (Credentials, error) {
+	result := &spnCredentials{
 		tenantId:     tenantId,
 		clientId:     clientId,
+		scope:        scope,
 		cachedSecret: util.EmptyIfNil(secret),
 		credhubRef:   credhubReference,
 	}
 
-	result.credhubClient, e = util.CredhubClient(credhubClient, credhubReference)
-	return
+	var e error
+	if result.credhubClient, e = newCredhubClient(credhubClient, credhubSecret); e != nil {
+		return nil, e
+	}
+	return result, nil
 }
@@ -0,0 +1,29 @@
+package azure
+
+import (
+	"testing"
+
+	"github.com/rabobank/config-hub/util"
+)
+
+func TestSpnCredhubClient(t *testing.T) {
+	defer func(original func(client, secret *string) (util.Credhub, error)) { newCredhubClient = original }(newCredhubClient)
+
+	var client, secret *string
+	newCredhubClient = func(c, s *string) (util.Credhub, error) {
+		client, secret = c, s
+		return nil, nil
+	}
+
+	credhubClient, credhubSecret, credhubReference := "uaa-client", "uaa-secret", "/spn/secret"
+	credentials, e := NewSpnCredentials("tenant", "spn", nil, &credhubClient, &credhubSecret, &credhubReference, KeyVaultScope)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if client == nil || *client != credhubClient || secret == nil || *secret != credhubSecret {
+		t.Errorf("expected the credhub client to authenticate with the uaa client and secret, got %v and %v", client, secret)
+	}
+	if reference := credentials.(*spnCredentials).credhubRef; reference == nil || *reference != credhubReference {
+		t.Errorf("expected the spn secret to be read from %s, got %v", credhubReference, reference)
+	}
+}
@@ -0,0 +1,322 @@
+package consul_source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-log"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/spi"
+	"github.com/rabobank/config-hub/util"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	InvalidConfigurationObjectError = csn.Error("expected a consul configuration object")
+	UnexpectedResponseError         = csn.ErrorF("unexpected response from consul for %s : %d")
+
+	KvEndpoint      = "%s/v1/kv/%s/?recurse=true"
+	WatchEndpoint   = "%s/v1/kv/%s/?recurse=true&keys=true&index=%d&wait=%ds"
+	ConsulIndex     = "X-Consul-Index"
+	ConsulToken     = "X-Consul-Token"
+	WatchRetryDelay = 5 * time.Second
+)
+
+var l, _ = log.GetWithOptions("CONSUL_SOURCE", log.Standard().WithFailingCriticals().WithLogPrefix(log.Name, log.LogLevel, log.Separator).WithStartingLevel(cfg.LogLevel))
+
+type kvPair struct {
+	Key   string  `json:"Key"`
+	Value *string `json:"Value"`
+}
+
+type source struct {
+	url       string
+	token     *string
+	prefix    string
+	separator string
+	format    string
+	dataKey   string
+	waitTime  int
+	timeout   time.Duration
+
+	// cached properties per consul context (e.g. "application,dev"). A nil map caches a non-existing context
+	cache    map[string]map[string]any
+	index    uint64
+	watching bool
+	stopped  chan struct{}
+
+	lock sync.Mutex
+}
+
+func (s *source) String() string {
+	return fmt.Sprintf("ConsulSource{url:%s, prefix:%s, format:%s}", s.url, s.prefix, s.format)
+}
+
+func (s *source) Name() string {
+	return fmt.Sprintf("%s/%s", s.url, s.prefix)
+}
+
+func (s *source) DashboardReport() *string {
+	return nil
+}
+
+func (s *source) ClearCache() {
+	l.Debugf("Clearing cache for consul source %s", s.url)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cache = make(map[string]map[string]any)
+}
+
+func (s *source) FindProperties(apps []string, profiles []string, _ string) ([]*domain.PropertySource, error) {
+	l.Debugf("Finding properties from consul source %s for app(s):%v and profiles:%s", s.url, apps, profiles)
+
+	if !util.HasApplication(apps) {
+		apps = append(apps, "application")
+	}
+
+	var result []*domain.PropertySource
+	for _, app := range apps {
+		for _, profile := range profiles {
+			if profile == "default" {
+				continue
+			}
+			if properties, e := s.properties(app + s.separator + profile); e != nil {
+				return nil, e
+			} else if properties != nil {
+				result = append(result, &domain.PropertySource{
+					Source:     fmt.Sprintf("consul-%s-%s", app, profile),
+					Properties: properties,
+				})
+			}
+		}
+		if properties, e := s.properties(app); e != nil {
+			return nil, e
+		} else if properties != nil {
+			result = append(result, &domain.PropertySource{
+				Source:     fmt.Sprintf("consul-%s", app),
+				Properties: properties,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// properties returns the properties of a consul context, served from cache as long as the watcher is able to tell
+// when the cached values become stale.
+func (s *source) properties(context string) (map[string]any, error) {
+	s.lock.Lock()
+	if properties, found := s.cache[context]; found && s.watching {
+		s.lock.Unlock()
+		return properties, nil
+	}
+	index := s.index
+	s.lock.Unlock()
+
+	properties, e := s.read(context)
+	if e != nil {
+		return nil, e
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// only cache if nothing has changed in the meantime
+	if s.watching && s.index == index {
+		s.cache[context] = properties
+	}
+	return properties, nil
+}
+
+func (s *source) request(endpoint string) *util.HttpRequest {
+	request := util.Request(endpoint)
+	if s.token != nil {
+		request.WithHeader(ConsulToken, *s.token)
+	}
+	return request
+}
+
+func (s *source) read(context string) (map[string]any, error) {
+	contextPath := s.prefix + "/" + context
+	l.Debugf("Reading consul context %s", contextPath)
+
+	response, e := s.request(fmt.Sprintf(KvEndpoint, s.url, contextPath)).Accepting("application/json").WithTimeout(s.timeout).DoWithResponse(http.MethodGet)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if response.StatusCode != http.StatusOK {
+		return nil, UnexpectedResponseError.WithValues(contextPath, response.StatusCode)
+	}
+
+	var pairs []kvPair
+	if e = json.NewDecoder(response.Body).Decode(&pairs); e != nil {
+		return nil, e
+	}
+
+	properties := make(map[string]any)
+	blob := s.format != domain.ConsulKeyValueFormat
+	found := false
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, contextPath+"/")
+		if len(key) == 0 || strings.HasSuffix(key, "/") {
+			// folder entries carry no values
+			continue
+		}
+
+		var value []byte
+		if pair.Value != nil {
+			if value, e = base64.StdEncoding.DecodeString(*pair.Value); e != nil {
+				return nil, e
+			}
+		}
+
+		switch s.format {
+		case domain.ConsulYamlFormat:
+			if key == s.dataKey {
+				found = true
+				if e = yaml.Unmarshal(value, &properties); e != nil {
+					return nil, e
+				}
+			}
+		case domain.ConsulPropertiesFormat:
+			if key == s.dataKey {
+				found = true
+				if properties, e = readProperties(bytes.NewReader(value)); e != nil {
+					return nil, e
+				}
+			}
+		default:
+			properties[strings.ReplaceAll(key, "/", ".")] = string(value)
+		}
+	}
+
+	if blob && !found {
+		// a context without the data key is not considered a property source
+		return nil, nil
+	}
+
+	return properties, nil
+}
+
+func readProperties(reader io.Reader) (map[string]any, error) {
+	scanner := bufio.NewScanner(reader)
+
+	properties := make(map[string]any)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found && !strings.HasPrefix(key, "#") {
+			properties[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return properties, scanner.Err()
+}
+
+// watch keeps a blocking query open on the source prefix and invalidates the cache whenever consul reports a new
+// index for it. While the watch is failing, properties are always read directly from consul.
+func (s *source) watch() {
+	for {
+		select {
+		case <-s.stopped:
+			return
+		default:
+		}
+
+		s.lock.Lock()
+		index := s.index
+		s.lock.Unlock()
+
+		newIndex, e := s.waitForChange(index)
+		s.lock.Lock()
+		if e != nil {
+			if s.watching {
+				l.Errorf("Unable to watch consul prefix %s, caching disabled : %v", s.prefix, e)
+			}
+			s.watching = false
+			s.index = 0
+			s.cache = make(map[string]map[string]any)
+		} else if newIndex != index || !s.watching {
+			l.Debugf("Consul prefix %s changed (index %d -> %d), clearing cache", s.prefix, index, newIndex)
+			s.cache = make(map[string]map[string]any)
+			// an index going backwards means consul has been reset, so start over from scratch
+			if newIndex < index {
+				newIndex = 0
+			}
+			s.index = newIndex
+			s.watching = true
+		}
+		s.lock.Unlock()
+
+		if e != nil {
+			select {
+			case <-s.stopped:
+				return
+			case <-time.After(WatchRetryDelay):
+			}
+		}
+	}
+}
+
+// watchTimeout is the timeout of the blocking queries, which consul may hold for up to the wait time and a sixteenth of
+// it, before the usual timeout
+func (s *source) watchTimeout() time.Duration {
+	wait := time.Duration(s.waitTime) * time.Second
+	return wait + wait/16 + s.timeout
+}
+
+func (s *source) waitForChange(index uint64) (uint64, error) {
+	response, e := s.request(fmt.Sprintf(WatchEndpoint, s.url, s.prefix, index, s.waitTime)).WithTimeout(s.watchTimeout()).DoWithResponse(http.MethodGet)
+	if e != nil {
+		return 0, e
+	}
+	defer func() { _ = response.Body.Close() }()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	// a missing prefix is not an error, consul still provides the index to wait on
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return 0, UnexpectedResponseError.WithValues(s.prefix, response.StatusCode)
+	}
+
+	return strconv.ParseUint(response.Header.Get(ConsulIndex), 10, 64)
+}
+
+func (s *source) stop() {
+	close(s.stopped)
+}
+
+func Source(sourceConfig domain.SourceConfig) (spi.Source, error) {
+	if consulConfig, isType := sourceConfig.(*domain.ConsulConfig); !isType {
+		return nil, InvalidConfigurationObjectError
+	} else {
+		s := &source{
+			url:       consulConfig.Url,
+			token:     consulConfig.Token,
+			prefix:    consulConfig.Prefix,
+			separator: consulConfig.ProfileSeparator,
+			format:    consulConfig.Format,
+			dataKey:   consulConfig.DataKey,
+			waitTime:  consulConfig.WaitTime,
+			timeout:   time.Duration(cfg.HttpTimeout) * time.Second,
+			cache:     make(map[string]map[string]any),
+			stopped:   make(chan struct{}),
+		}
+
+		go s.watch()
+
+		return s, nil
+	}
+}
@@ -0,0 +1,211 @@
+package consul_source
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+// consulStandIn is a minimal in-memory stand-in for the consul kv api, supporting recursive reads and blocking
+// queries on the kv index
+type consulStandIn struct {
+	kv      map[string]string
+	index   uint64
+	changed chan struct{}
+	lock    sync.Mutex
+}
+
+func newConsulStandIn() *consulStandIn {
+	return &consulStandIn{kv: make(map[string]string), index: 1, changed: make(chan struct{})}
+}
+
+func (c *consulStandIn) put(key, value string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.kv[key] = value
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *consulStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+
+	c.lock.Lock()
+	if index, e := strconv.ParseUint(query.Get("index"), 10, 64); e == nil && index == c.index {
+		changed := c.changed
+		c.lock.Unlock()
+		wait, _ := time.ParseDuration(query.Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		}
+		c.lock.Lock()
+	}
+	defer c.lock.Unlock()
+
+	var pairs []map[string]any
+	var keys []string
+	for key, value := range c.kv {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+			pairs = append(pairs, map[string]any{"Key": key, "Value": base64.StdEncoding.EncodeToString([]byte(value))})
+		}
+	}
+
+	w.Header().Set(ConsulIndex, strconv.FormatUint(c.index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if query.Has("keys") {
+		sort.Strings(keys)
+		_ = json.NewEncoder(w).Encode(keys)
+	} else {
+		_ = json.NewEncoder(w).Encode(pairs)
+	}
+}
+
+func newTestSource(t *testing.T, consul *consulStandIn, format string) *source {
+	server := httptest.NewServer(consul)
+	config := &domain.ConsulConfig{}
+	if e := config.FromMap(map[string]any{"type": "consul", "url": server.URL, "format": format, "waitTime": float64(1)}); e != nil {
+		t.Fatal(e)
+	}
+	s, e := Source(config)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() {
+		s.(*source).stop()
+		server.Close()
+	})
+	return s.(*source)
+}
+
+func waitUntilWatching(t *testing.T, s *source, index uint64) {
+	for i := 0; i < 100; i++ {
+		s.lock.Lock()
+		watching := s.watching && s.index >= index
+		s.lock.Unlock()
+		if watching {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("source never started watching consul")
+}
+
+func find(t *testing.T, s *source, app string, profiles ...string) map[string]map[string]any {
+	result := make(map[string]map[string]any)
+	if sources, e := s.FindProperties([]string{app}, profiles, ""); e != nil {
+		t.Fatal(e)
+	} else {
+		for _, source := range sources {
+			result[source.Source] = source.Properties
+		}
+	}
+	return result
+}
+
+func TestKeyValueLayout(t *testing.T) {
+	consul := newConsulStandIn()
+	consul.put("config/application/spring/datasource/url", "jdbc:shared")
+	consul.put("config/app,dev/spring/datasource/url", "jdbc:dev")
+	consul.put("config/app,dev/folder/", "")
+	s := newTestSource(t, consul, domain.ConsulKeyValueFormat)
+
+	sources := find(t, s, "app", "dev")
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 property sources, got %v", sources)
+	}
+	if v := sources["consul-app-dev"]["spring.datasource.url"]; v != "jdbc:dev" {
+		t.Errorf("Expected jdbc:dev for app,dev, got %v", v)
+	}
+	if v := sources["consul-application"]["spring.datasource.url"]; v != "jdbc:shared" {
+		t.Errorf("Expected jdbc:shared for application, got %v", v)
+	}
+	if _, found := sources["consul-app-dev"]["folder."]; found {
+		t.Errorf("Folder keys should not be exposed as properties")
+	}
+}
+
+func TestBlobLayouts(t *testing.T) {
+	consul := newConsulStandIn()
+	consul.put("config/app/data", "spring:\n  datasource:\n    url: jdbc:yaml\n")
+	s := newTestSource(t, consul, domain.ConsulYamlFormat)
+
+	sources := find(t, s, "app", "default")
+	datasource, _ := sources["consul-app"]["spring"].(map[string]any)["datasource"].(map[string]any)
+	if datasource["url"] != "jdbc:yaml" {
+		t.Errorf("Expected jdbc:yaml, got %v", sources)
+	}
+
+	consul = newConsulStandIn()
+	consul.put("config/app/data", "# comment\nspring.datasource.url = jdbc:properties\n")
+	consul.put("config/app/other", "ignored=true")
+	s = newTestSource(t, consul, domain.ConsulPropertiesFormat)
+
+	sources = find(t, s, "app", "default")
+	if v := sources["consul-app"]["spring.datasource.url"]; v != "jdbc:properties" {
+		t.Errorf("Expected jdbc:properties, got %v", v)
+	}
+	if len(sources["consul-app"]) != 1 {
+		t.Errorf("Expected only the data key to be read, got %v", sources["consul-app"])
+	}
+}
+
+func TestBlockingQueryInvalidatesCache(t *testing.T) {
+	consul := newConsulStandIn()
+	consul.put("config/app/greeting", "hello")
+	s := newTestSource(t, consul, domain.ConsulKeyValueFormat)
+	waitUntilWatching(t, s, consul.index)
+
+	if v := find(t, s, "app")["consul-app"]["greeting"]; v != "hello" {
+		t.Fatalf("Expected hello, got %v", v)
+	}
+	s.lock.Lock()
+	_, cached := s.cache["app"]
+	s.lock.Unlock()
+	if !cached {
+		t.Fatal("Expected properties to be cached while watching")
+	}
+
+	consul.put("config/app/greeting", "bye")
+	waitUntilWatching(t, s, consul.index)
+
+	if v := find(t, s, "app")["consul-app"]["greeting"]; v != "bye" {
+		t.Errorf("Expected the change to invalidate the cache, got %v", v)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer server.Close()
+	defer close(release)
+
+	s := &source{url: server.URL, prefix: "config", separator: ",", format: domain.ConsulKeyValueFormat, waitTime: 16, timeout: 100 * time.Millisecond, cache: make(map[string]map[string]any)}
+	start := time.Now()
+	if _, e := s.FindProperties([]string{"app"}, []string{"default"}, ""); e == nil {
+		t.Errorf("expected reads of an unresponsive consul to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected reads to time out after %v, took %v", s.timeout, elapsed)
+	}
+
+	// blocking queries are held by consul up to the wait time and a sixteenth of it
+	if timeout := s.watchTimeout(); timeout != 17*time.Second+s.timeout {
+		t.Errorf("expected blocking queries to time out after 17.1s, got %v", timeout)
+	}
+}
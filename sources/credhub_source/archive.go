@@ -0,0 +1,265 @@
+package credhub_source
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const (
+	ArchiveVersion   = 1
+	ArchiveAlgorithm = "RSA-OAEP-256+A256GCM"
+
+	SkipPolicy      = "skip"
+	OverwritePolicy = "overwrite"
+	MergePolicy     = "merge"
+
+	CreateAction = "create"
+
+	InvalidKeyError           = csn.Error("expected a PEM encoded RSA key")
+	NoArchiveKeyError         = csn.Error("no ARCHIVE_PRIVATE_KEY configured to decrypt imported archives")
+	UnsupportedArchiveError   = csn.ErrorF("unsupported archive version %d or algorithm %s")
+	InvalidArchiveError       = csn.Error("unable to decrypt the archive with the archive private key")
+	UnknownImportPolicyError  = csn.ErrorF("unknown import policy %s, expected skip, overwrite or merge")
+	InvalidImportedScopeError = csn.ErrorF("invalid imported secrets %s/%s/%s, app, profile and label can't be empty nor contain /")
+)
+
+// exportSecrets reads all the credentials under the source prefix and encrypts them for the given public key
+func (s *source) exportSecrets(publicKeyPem string) (*domain.SecretsArchive, error) {
+	publicKey, e := parsePublicKey(publicKeyPem)
+	if e != nil {
+		return nil, e
+	}
+
+	existingCredentials, e := s.getExistingCredentials()
+	if e != nil {
+		return nil, e
+	}
+
+	export := &domain.ExportedSecrets{Source: s.name, ExportedAt: time.Now().UTC(), Secrets: make([]domain.ExportedSecret, 0)}
+	for _, credReference := range existingCredentials.filterCredentials(nil, nil, nil) {
+		if credential, e := s.client.GetJsonByName(credReference.name); e != nil {
+			l.Errorf("Failed to retrieve credential %s : %v", credReference.name, e)
+			return nil, e
+		} else {
+			export.Secrets = append(export.Secrets, domain.ExportedSecret{
+				App:     credReference.app,
+				Profile: credReference.profile,
+				Label:   credReference.label,
+				Secrets: credential,
+			})
+		}
+	}
+	sort.Slice(export.Secrets, func(i, j int) bool {
+		a, b := export.Secrets[i], export.Secrets[j]
+		return a.App+"/"+a.Profile+"/"+a.Label < b.App+"/"+b.Profile+"/"+b.Label
+	})
+
+	l.Infof("Exporting %d credentials from credhub source %s", len(export.Secrets), s.name)
+	return encryptArchive(publicKey, export)
+}
+
+// importArchive decrypts an archive exported with the public key of the archive private key and imports its secrets
+func (s *source) importArchive(archive *domain.SecretsArchive, policy string, dryRun bool) (*domain.ImportReport, error) {
+	if s.archiveKey == nil {
+		return nil, NoArchiveKeyError
+	}
+	export, e := decryptArchive(s.archiveKey, archive)
+	if e != nil {
+		return nil, e
+	}
+	return s.importSecrets(export, policy, dryRun)
+}
+
+// importSecrets replays exported secrets through the added secrets path according to the conflict policy, reporting
+// the changes. Overwritten secrets replace the existing ones, dropping the metadata of the removed keys. On a dry-run
+// nothing is written.
+func (s *source) importSecrets(export *domain.ExportedSecrets, policy string, dryRun bool) (*domain.ImportReport, error) {
+	if policy != SkipPolicy && policy != OverwritePolicy && policy != MergePolicy {
+		return nil, UnknownImportPolicyError.WithValues(policy)
+	}
+
+	// the scopes become credhub names, all of them are checked before anything is written
+	for _, exported := range export.Secrets {
+		if !validScopeSegment(exported.App) || !validScopeSegment(exported.Profile) || !validScopeSegment(exported.Label) {
+			return nil, InvalidImportedScopeError.WithValues(exported.App, exported.Profile, exported.Label)
+		}
+	}
+
+	existingCredentials, e := s.getExistingCredentials()
+	if e != nil {
+		return nil, e
+	}
+
+	report := &domain.ImportReport{DryRun: dryRun, Policy: policy, Changes: make([]domain.ImportChange, 0)}
+	for _, exported := range export.Secrets {
+		var existing map[string]any
+		if existingCredentials.contains(exported.App, exported.Profile, exported.Label) {
+			credentialName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, exported.App, exported.Profile, exported.Label)
+			if existing, e = s.client.GetJsonByName(credentialName); e != nil {
+				l.Errorf("Unable to read credentials %s\n", credentialName)
+				return nil, e
+			}
+		}
+
+		change := importChange(exported, existing, policy)
+		report.Changes = append(report.Changes, change)
+		if dryRun || change.Action == SkipPolicy {
+			continue
+		}
+
+		apps, profiles, labels := []string{exported.App}, []string{exported.Profile}, []string{exported.Label}
+		if change.Action == OverwritePolicy {
+			e = s.writeSecrets(apps, profiles, labels, exported.Secrets, false)
+		} else {
+			e = s.addSecrets(apps, profiles, labels, exported.Secrets)
+		}
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	l.Infof("Imported %d credentials into credhub source %s with policy %s (dry-run: %v)", len(report.Changes), s.name, policy, dryRun)
+	return report, nil
+}
+
+func validScopeSegment(segment string) bool {
+	return len(segment) != 0 && !strings.Contains(segment, "/")
+}
+
+// importChange determines what importing exported secrets over the existing ones does under the given policy
+func importChange(exported domain.ExportedSecret, existing map[string]any, policy string) domain.ImportChange {
+	change := domain.ImportChange{App: exported.App, Profile: exported.Profile, Label: exported.Label}
+	switch {
+	case existing == nil:
+		change.Action = CreateAction
+		change.Added, change.Changed, change.Removed = changedKeys(nil, exported.Secrets)
+	case policy == SkipPolicy:
+		change.Action = SkipPolicy
+	case policy == OverwritePolicy:
+		change.Action = OverwritePolicy
+		change.Added, change.Changed, change.Removed = changedKeys(existing, exported.Secrets)
+	default:
+		change.Action = MergePolicy
+		change.Added, change.Changed, change.Removed = changedKeys(existing, mergeSecrets(flattenSecrets("", existing), flattenSecrets("", exported.Secrets)))
+	}
+	return change
+}
+
+func encryptArchive(publicKey *rsa.PublicKey, export *domain.ExportedSecrets) (*domain.SecretsArchive, error) {
+	content, e := json.Marshal(export)
+	if e != nil {
+		return nil, e
+	}
+
+	key := make([]byte, 32)
+	if _, e = rand.Read(key); e != nil {
+		return nil, e
+	}
+	gcm, e := newGcm(key)
+	if e != nil {
+		return nil, e
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, e = rand.Read(nonce); e != nil {
+		return nil, e
+	}
+
+	encryptedKey, e := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if e != nil {
+		return nil, e
+	}
+
+	return &domain.SecretsArchive{
+		Version:   ArchiveVersion,
+		Algorithm: ArchiveAlgorithm,
+		Key:       base64.StdEncoding.EncodeToString(encryptedKey),
+		Nonce:     base64.StdEncoding.EncodeToString(nonce),
+		Data:      base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, content, nil)),
+	}, nil
+}
+
+func decryptArchive(privateKey *rsa.PrivateKey, archive *domain.SecretsArchive) (*domain.ExportedSecrets, error) {
+	if archive.Version != ArchiveVersion || archive.Algorithm != ArchiveAlgorithm {
+		return nil, UnsupportedArchiveError.WithValues(archive.Version, archive.Algorithm)
+	}
+
+	encryptedKey, e1 := base64.StdEncoding.DecodeString(archive.Key)
+	nonce, e2 := base64.StdEncoding.DecodeString(archive.Nonce)
+	data, e3 := base64.StdEncoding.DecodeString(archive.Data)
+	if e1 != nil || e2 != nil || e3 != nil {
+		return nil, InvalidArchiveError
+	}
+
+	key, e := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedKey, nil)
+	if e != nil {
+		return nil, InvalidArchiveError
+	}
+	gcm, e := newGcm(key)
+	if e != nil || len(nonce) != gcm.NonceSize() {
+		return nil, InvalidArchiveError
+	}
+	content, e := gcm.Open(nil, nonce, data, nil)
+	if e != nil {
+		return nil, InvalidArchiveError
+	}
+
+	result := &domain.ExportedSecrets{}
+	if e = json.Unmarshal(content, result); e != nil {
+		return nil, InvalidArchiveError
+	}
+	return result, nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+func parsePublicKey(publicKeyPem string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPem))
+	if block == nil {
+		return nil, InvalidKeyError
+	}
+	if key, e := x509.ParsePKCS1PublicKey(block.Bytes); e == nil {
+		return key, nil
+	}
+	if key, e := x509.ParsePKIXPublicKey(block.Bytes); e == nil {
+		if rsaKey, isRsa := key.(*rsa.PublicKey); isRsa {
+			return rsaKey, nil
+		}
+	}
+	return nil, InvalidKeyError
+}
+
+func parsePrivateKey(privateKeyPem string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPem))
+	if block == nil {
+		return nil, InvalidKeyError
+	}
+	if key, e := x509.ParsePKCS1PrivateKey(block.Bytes); e == nil {
+		return key, nil
+	}
+	if key, e := x509.ParsePKCS8PrivateKey(block.Bytes); e == nil {
+		if rsaKey, isRsa := key.(*rsa.PrivateKey); isRsa {
+			return rsaKey, nil
+		}
+	}
+	return nil, InvalidKeyError
+}
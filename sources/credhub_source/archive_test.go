@@ -0,0 +1,106 @@
+package credhub_source
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"testing"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func generateKeys(t *testing.T) (string, string) {
+	key, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Fatal(e)
+	}
+	publicKey, e := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	publicKeyPem, privateKeyPem := generateKeys(t)
+	exporting, _ := newFakeSource(map[string]any{
+		"/prefix/app/default/master/secrets": map[string]any{"password": "secret", "token": "new"},
+		"/prefix/other/dev/master/secrets":   map[string]any{"key": "value"},
+	})
+	archive, e := exporting.exportSecrets(publicKeyPem)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	importing, client := newFakeSource(map[string]any{
+		"/prefix/app/default/master/secrets":  map[string]any{"password": "old", "removed": "x"},
+		"/prefix/app/default/master/metadata": map[string]any{"removed": map[string]any{"owner": "team"}, "password": map[string]any{"owner": "team"}},
+	})
+	if _, e = importing.importArchive(archive, OverwritePolicy, false); e != NoArchiveKeyError {
+		t.Errorf("expected archives not to be imported without archive key, got %v", e)
+	}
+
+	_, otherPrivateKeyPem := generateKeys(t)
+	if importing.archiveKey, e = parsePrivateKey(otherPrivateKeyPem); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = importing.importArchive(archive, OverwritePolicy, false); e != InvalidArchiveError {
+		t.Errorf("expected the archive not to be decrypted with another key, got %v", e)
+	}
+
+	if importing.archiveKey, e = parsePrivateKey(privateKeyPem); e != nil {
+		t.Fatal(e)
+	}
+	report, e := importing.importArchive(archive, OverwritePolicy, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(report.Changes) != 2 || report.Changes[0].Action != OverwritePolicy || report.Changes[1].Action != CreateAction {
+		t.Errorf("unexpected import report %v", report.Changes)
+	}
+	if secrets := client.credentials["/prefix/app/default/master/secrets"]; !reflect.DeepEqual(secrets, map[string]any{"password": "secret", "token": "new"}) {
+		t.Errorf("expected the secrets to be overwritten, got %v", secrets)
+	}
+	if secrets := client.credentials["/prefix/other/dev/master/secrets"]; !reflect.DeepEqual(secrets, map[string]any{"key": "value"}) {
+		t.Errorf("expected the secrets to be created, got %v", secrets)
+	}
+	if metadata := client.credentials["/prefix/app/default/master/metadata"].(map[string]any); len(metadata) != 1 || metadata["password"] == nil {
+		t.Errorf("expected the metadata of the overwritten keys to be dropped, got %v", metadata)
+	}
+}
+
+func TestImportedScopes(t *testing.T) {
+	s := &source{name: "credhub", prefix: "/config-hub/"}
+	for _, scope := range [][3]string{{"", "default", "master"}, {"app", "", "master"}, {"app", "default", ""}, {"../other", "default", "master"}, {"app", "default", "release/1"}} {
+		export := &domain.ExportedSecrets{Secrets: []domain.ExportedSecret{{App: scope[0], Profile: scope[1], Label: scope[2], Secrets: map[string]any{"key": "value"}}}}
+		if _, e := s.importSecrets(export, SkipPolicy, true); !InvalidImportedScopeError.IsKindOf(e) {
+			t.Errorf("expected secrets imported for %v to be rejected, got %v", scope, e)
+		}
+	}
+}
+
+func TestImportChange(t *testing.T) {
+	exported := domain.ExportedSecret{App: "app", Profile: "default", Label: "master", Secrets: map[string]any{"a": "1", "b": "2"}}
+	existing := map[string]any{"a": "0", "c": "3"}
+
+	if change := importChange(exported, nil, SkipPolicy); change.Action != CreateAction || !reflect.DeepEqual(change.Added, []string{"a", "b"}) {
+		t.Errorf("unexpected change for new secrets %v", change)
+	}
+	if change := importChange(exported, existing, SkipPolicy); change.Action != SkipPolicy || change.Added != nil {
+		t.Errorf("unexpected change when skipping %v", change)
+	}
+	if change := importChange(exported, existing, OverwritePolicy); !reflect.DeepEqual(change.Removed, []string{"c"}) ||
+		!reflect.DeepEqual(change.Changed, []string{"a"}) || !reflect.DeepEqual(change.Added, []string{"b"}) {
+		t.Errorf("unexpected change when overwriting %v", change)
+	}
+	if change := importChange(exported, existing, MergePolicy); change.Removed != nil ||
+		!reflect.DeepEqual(change.Changed, []string{"a"}) || !reflect.DeepEqual(change.Added, []string{"b"}) {
+		t.Errorf("unexpected change when merging %v", change)
+	}
+	if existing["a"] != "0" {
+		t.Errorf("existing secrets must not be modified when computing changes")
+	}
+}
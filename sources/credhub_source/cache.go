@@ -0,0 +1,129 @@
+package credhub_source
+
+import (
+	"sync"
+	"time"
+)
+
+// cache keeps the credential index of a credhub source and the values, or just the key names for listings, of the
+// credentials read through it for a limited time. A ttl of 0 disables caching altogether.
+type cache struct {
+	ttl        time.Duration
+	lock       sync.Mutex
+	expiration time.Time
+	index      *credentialsIndex
+	values     map[string]map[string]any
+	names      map[string][]string
+
+	// incremented on every invalidation, so values loaded before a write are not cached after it
+	generation uint64
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl}
+}
+
+func (c *cache) enabled() bool {
+	return c.ttl > 0
+}
+
+// getIndex returns the cached credential index, loading it if the cache is expired or was invalidated
+func (c *cache) getIndex(load func() (*credentialsIndex, error)) (*credentialsIndex, error) {
+	if !c.enabled() {
+		return load()
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.index == nil || time.Now().After(c.expiration) {
+		index, e := load()
+		if e != nil {
+			return nil, e
+		}
+		c.index = index
+		c.values = make(map[string]map[string]any)
+		c.names = make(map[string][]string)
+		c.expiration = time.Now().Add(c.ttl)
+	}
+	return c.index, nil
+}
+
+// getValue returns a copy of the cached value of the credential with the given name, loading it if not cached yet, so
+// callers can't alter the cache. Values are only kept while the index they were found with is valid.
+func (c *cache) getValue(name string, load func(string) (map[string]any, error)) (map[string]any, error) {
+	value, e := lookup(c, &c.values, name, load)
+	if e != nil || !c.enabled() {
+		return value, e
+	}
+	return copyValue(value).(map[string]any), nil
+}
+
+// getNames returns the cached key names of the credential with the given name, loading them if not cached yet
+func (c *cache) getNames(name string, load func(string) ([]string, error)) ([]string, error) {
+	return lookup(c, &c.names, name, load)
+}
+
+// copyValue deep copies the maps and lists of a credential value
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, element := range v {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, element := range v {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	}
+	return value
+}
+
+func lookup[T any](c *cache, entries *map[string]T, name string, load func(string) (T, error)) (T, error) {
+	if !c.enabled() {
+		return load(name)
+	}
+
+	c.lock.Lock()
+	if entry, found := (*entries)[name]; found && time.Now().Before(c.expiration) {
+		c.lock.Unlock()
+		return entry, nil
+	}
+	generation := c.generation
+	c.lock.Unlock()
+
+	entry, e := load(name)
+	if e != nil {
+		return entry, e
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if *entries != nil && generation == c.generation {
+		(*entries)[name] = entry
+	}
+	return entry, nil
+}
+
+// invalidate drops the cached value of the given credential and the index, as the write may have created it
+func (c *cache) invalidate(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.index = nil
+	delete(c.values, name)
+	delete(c.names, name)
+}
+
+func (c *cache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.index = nil
+	c.values = nil
+	c.names = nil
+	c.expiration = time.Time{}
+}
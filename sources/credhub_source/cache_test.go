@@ -0,0 +1,79 @@
+package credhub_source
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheInvalidation(t *testing.T) {
+	c := newCache(time.Minute)
+	indexLoads, valueLoads := 0, 0
+	loadIndex := func() (*credentialsIndex, error) {
+		indexLoads++
+		index := newCredentialsIndex()
+		index.add("/prefix/app/default/master/secrets")
+		return index, nil
+	}
+	loadValue := func(name string) (map[string]any, error) {
+		valueLoads++
+		return map[string]any{"loads": valueLoads}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, e := c.getIndex(loadIndex); e != nil {
+			t.Fatal(e)
+		}
+		if value, e := c.getValue("/prefix/app/default/master/secrets", loadValue); e != nil {
+			t.Fatal(e)
+		} else if value["loads"] != 1 {
+			t.Errorf("expected cached value, got %v", value)
+		}
+	}
+	if indexLoads != 1 || valueLoads != 1 {
+		t.Errorf("expected a single load of index and value, got %d and %d", indexLoads, valueLoads)
+	}
+
+	c.invalidate("/prefix/app/default/master/secrets")
+	c.getIndex(loadIndex)
+	if value, _ := c.getValue("/prefix/app/default/master/secrets", loadValue); value["loads"] != 2 {
+		t.Errorf("expected value to be reloaded after a write, got %v", value)
+	}
+
+	c.clear()
+	c.getIndex(loadIndex)
+	if indexLoads != 3 {
+		t.Errorf("expected index to be reloaded after clearing the cache, got %d loads", indexLoads)
+	}
+}
+
+func TestDisabledCache(t *testing.T) {
+	c := newCache(0)
+	loads := 0
+	for i := 0; i < 2; i++ {
+		c.getValue("name", func(string) (map[string]any, error) {
+			loads++
+			return map[string]any{}, nil
+		})
+	}
+	if loads != 2 {
+		t.Errorf("expected every read to hit credhub with caching disabled, got %d loads", loads)
+	}
+}
+
+func TestCachedValuesCopied(t *testing.T) {
+	c := newCache(time.Minute)
+	c.getIndex(func() (*credentialsIndex, error) { return newCredentialsIndex(), nil })
+	load := func(name string) (map[string]any, error) {
+		return map[string]any{"hosts": []any{"a", "b"}, "db": map[string]any{"password": "secret"}}, nil
+	}
+
+	value, _ := c.getValue("/prefix/app/default/master/secrets", load)
+	value["hosts"].([]any)[0] = "altered"
+	value["db"].(map[string]any)["password"] = "altered"
+	value["added"] = true
+
+	if value, _ = c.getValue("/prefix/app/default/master/secrets", load); value["hosts"].([]any)[0] != "a" ||
+		value["db"].(map[string]any)["password"] != "secret" || value["added"] != nil {
+		t.Errorf("expected callers not to alter the cached value, got %v", value)
+	}
+}
@@ -0,0 +1,119 @@
+package credhub_source
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const (
+	CopiedResult      = "copied"
+	OverwrittenResult = "overwritten"
+	UnchangedResult   = "unchanged"
+	ConflictResult    = "conflict"
+	MissingResult     = "missing"
+
+	SourceSecretsNotFoundError = csn.ErrorF("no secrets found for app %s, profile %s and label %s")
+)
+
+// copySecrets copies secrets from one app/profile/label to another, reporting the result for each key. Keys already
+// existing in the target with a different value are only overwritten when forced.
+func (s *source) copySecrets(from, to domain.SecretScope, keys []string, force bool) ([]domain.CopiedSecret, error) {
+	from, to = defaultScope(from), defaultScope(to)
+	existingCredentials, e := s.getExistingCredentials()
+	if e != nil {
+		return nil, e
+	}
+	if !existingCredentials.contains(from.App, from.Profile, from.Label) {
+		return nil, SourceSecretsNotFoundError.WithValues(from.App, from.Profile, from.Label)
+	}
+
+	fromName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, from.App, from.Profile, from.Label)
+	fromSecrets, e := s.client.GetJsonByName(fromName)
+	if e != nil {
+		l.Errorf("Unable to read credentials %s\n", fromName)
+		return nil, e
+	}
+
+	toSecrets := make(map[string]any)
+	if existingCredentials.contains(to.App, to.Profile, to.Label) {
+		toName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, to.App, to.Profile, to.Label)
+		if existing, e := s.client.GetJsonByName(toName); e != nil {
+			l.Errorf("Unable to read credentials %s\n", toName)
+			return nil, e
+		} else {
+			toSecrets = flattenSecrets("", existing)
+		}
+	}
+
+	report, copied := copyReport(flattenSecrets("", fromSecrets), toSecrets, keys, force)
+	if len(copied) > 0 {
+		if e = s.addSecrets([]string{to.App}, []string{to.Profile}, []string{to.Label}, copied); e != nil {
+			return nil, e
+		}
+	}
+	l.Infof("Copied %d secrets from %s/%s/%s to %s/%s/%s", len(copied), from.App, from.Profile, from.Label, to.App, to.Profile, to.Label)
+	return report, nil
+}
+
+// copyReport selects the secrets to copy from secrets in canonical form and reports the result for each key
+func copyReport(from, to map[string]any, keys []string, force bool) ([]domain.CopiedSecret, map[string]any) {
+	report := make([]domain.CopiedSecret, 0)
+	copied := make(map[string]any)
+
+	selected := make([]string, 0, len(from))
+	matched := make(map[string]bool)
+	for key := range from {
+		if len(keys) == 0 {
+			selected = append(selected, key)
+		}
+		for _, filter := range keys {
+			if key == filter || strings.HasPrefix(key, filter+".") {
+				selected = append(selected, key)
+				matched[filter] = true
+				break
+			}
+		}
+	}
+	sort.Strings(selected)
+
+	for _, key := range selected {
+		existing, exists := to[key]
+		switch {
+		case !exists:
+			copied[key] = from[key]
+			report = append(report, domain.CopiedSecret{Key: key, Result: CopiedResult})
+		case reflect.DeepEqual(existing, from[key]):
+			report = append(report, domain.CopiedSecret{Key: key, Result: UnchangedResult})
+		case force:
+			copied[key] = from[key]
+			report = append(report, domain.CopiedSecret{Key: key, Result: OverwrittenResult})
+		default:
+			report = append(report, domain.CopiedSecret{Key: key, Result: ConflictResult})
+		}
+	}
+
+	for _, filter := range keys {
+		if !matched[filter] {
+			report = append(report, domain.CopiedSecret{Key: filter, Result: MissingResult})
+		}
+	}
+	return report, copied
+}
+
+func defaultScope(scope domain.SecretScope) domain.SecretScope {
+	if len(scope.App) == 0 {
+		scope.App = "application"
+	}
+	if len(scope.Profile) == 0 {
+		scope.Profile = "default"
+	}
+	if len(scope.Label) == 0 {
+		scope.Label = "master"
+	}
+	return scope
+}
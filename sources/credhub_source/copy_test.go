@@ -0,0 +1,45 @@
+package credhub_source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestCopyReport(t *testing.T) {
+	from := map[string]any{"db.password": "p1", "db.username": "u", "token": "t", "other": "o"}
+	to := map[string]any{"db.password": "p0", "db.username": "u"}
+
+	report, copied := copyReport(from, to, []string{"db", "token", "unknown"}, false)
+	expected := []domain.CopiedSecret{
+		{Key: "db.password", Result: ConflictResult},
+		{Key: "db.username", Result: UnchangedResult},
+		{Key: "token", Result: CopiedResult},
+		{Key: "unknown", Result: MissingResult},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %v, got %v", expected, report)
+	}
+	if !reflect.DeepEqual(copied, map[string]any{"token": "t"}) {
+		t.Errorf("unexpected copied secrets %v", copied)
+	}
+
+	report, copied = copyReport(from, to, nil, true)
+	if len(report) != 4 || len(copied) != 3 || copied["db.password"] != "p1" {
+		t.Errorf("expected all secrets to be copied when forced, got %v", copied)
+	}
+}
+
+func TestCopiedKeys(t *testing.T) {
+	report := []domain.CopiedSecret{
+		{Key: "db.password", Result: OverwrittenResult},
+		{Key: "db.username", Result: UnchangedResult},
+		{Key: "token", Result: CopiedResult},
+	}
+	keys := copiedKeys(domain.SecretScope{App: "app", Profile: "dev"}, domain.SecretScope{App: "other", Profile: "prd", Label: "v1"}, report)
+	expected := []string{"app/dev/master/db.password", "other/prd/v1/db.password", "app/dev/master/token", "other/prd/v1/token"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
@@ -0,0 +1,114 @@
+package credhub_source
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rabobank/config-hub/util"
+	"github.com/rabobank/credhub-client"
+)
+
+// fakeCredhub keeps credentials in memory and generates predictable passwords
+type fakeCredhub struct {
+	util.Credhub
+	lock        sync.Mutex
+	credentials map[string]any
+	generated   int
+	parameters  []map[string]any
+	versions    map[string]*credhub.Credential[map[string]any]
+	failing     map[string]bool
+}
+
+func newFakeSource(credentials map[string]any) (*source, *fakeCredhub) {
+	client := &fakeCredhub{credentials: credentials}
+	return &source{name: "credhub", prefix: "/prefix/", client: client, cache: newCache(0)}, client
+}
+
+func (f *fakeCredhub) FindByPath(path string) (*credhub.CredentialNames, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := &credhub.CredentialNames{}
+	for name := range f.credentials {
+		if strings.HasPrefix(name, path) {
+			result.Credentials = append(result.Credentials, struct {
+				Name             string    `json:"name"`
+				VersionCreatedAt time.Time `json:"version_created_at"`
+			}{Name: name})
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeCredhub) FindByName(name string) (*credhub.CredentialNames, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := &credhub.CredentialNames{}
+	for credential := range f.credentials {
+		if strings.Contains(credential, name) {
+			result.Credentials = append(result.Credentials, struct {
+				Name             string    `json:"name"`
+				VersionCreatedAt time.Time `json:"version_created_at"`
+			}{Name: credential})
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeCredhub) GetJsonByName(name string) (map[string]any, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.failing[name] {
+		return nil, errors.New("credhub unavailable")
+	}
+	if value, isJson := f.credentials[name].(map[string]any); isJson {
+		return copyOf(value), nil
+	}
+	return nil, errors.New("no data")
+}
+
+func (f *fakeCredhub) SetJsonByName(name string, value map[string]any) (*credhub.Credential[map[string]any], error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.credentials[name] = copyOf(value)
+	return &credhub.Credential[map[string]any]{Name: name, Type: "json", Value: value}, nil
+}
+
+func (f *fakeCredhub) GetJsonCredentialById(id string) (*credhub.Credential[map[string]any], error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if version, found := f.versions[id]; found {
+		return version, nil
+	}
+	return nil, errors.New("no data")
+}
+
+func (f *fakeCredhub) GenerateByName(name string, credentialType string, parameters map[string]any) (*credhub.Credential[any], error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.generated++
+	f.parameters = append(f.parameters, parameters)
+	value := fmt.Sprintf("%s-%d", credentialType, f.generated)
+	f.credentials[name] = value
+	return &credhub.Credential[any]{Name: name, Type: credentialType, Value: value}, nil
+}
+
+func (f *fakeCredhub) DeleteByName(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.credentials, name)
+	return nil
+}
+
+func copyOf(value map[string]any) map[string]any {
+	result := make(map[string]any, len(value))
+	for k, v := range value {
+		if nested, isMap := v.(map[string]any); isMap {
+			v = copyOf(nested)
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package credhub_source
+
+import (
+	"sync"
+)
+
+// maxConcurrentReads bounds the number of credentials read from credhub in parallel for a single request
+const maxConcurrentReads = 8
+
+type fetched[T any] struct {
+	value T
+	e     error
+}
+
+// fetchAll reads the named credentials with bounded concurrency. Every name is only read once, even when requested
+// multiple times.
+func fetchAll[T any](names []string, fetch func(string) (T, error)) map[string]fetched[T] {
+	result := make(map[string]fetched[T], len(names))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxConcurrentReads)
+	requested := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		if requested[name] {
+			continue
+		}
+		requested[name] = true
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(name string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			value, e := fetch(name)
+			lock.Lock()
+			result[name] = fetched[T]{value, e}
+			lock.Unlock()
+		}(name)
+	}
+
+	wg.Wait()
+	return result
+}
@@ -0,0 +1,73 @@
+package credhub_source
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchAll(t *testing.T) {
+	var lock sync.Mutex
+	reads := make(map[string]int)
+	running, maxRunning := 0, 0
+	fetch := func(name string) (string, error) {
+		lock.Lock()
+		reads[name]++
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		if name == "failing" {
+			return "", errors.New("failed")
+		}
+		return "value-" + name, nil
+	}
+
+	var names []string
+	for i := 0; i < 3*maxConcurrentReads; i++ {
+		names = append(names, string(rune('a'+i)), string(rune('a'+i)))
+	}
+	names = append(names, "failing")
+
+	result := fetchAll(names, fetch)
+	if len(result) != 3*maxConcurrentReads+1 {
+		t.Errorf("expected one result per distinct name, got %d", len(result))
+	}
+	for name, count := range reads {
+		if count != 1 {
+			t.Errorf("expected %s to be read once, was read %d times", name, count)
+		}
+	}
+	if maxRunning > maxConcurrentReads {
+		t.Errorf("expected at most %d concurrent reads, got %d", maxConcurrentReads, maxRunning)
+	}
+	if result["a"].value != "value-a" || result["failing"].e == nil {
+		t.Errorf("unexpected results %v", result)
+	}
+}
+
+func TestListSecretsKeepsNamesOnly(t *testing.T) {
+	s, _ := newFakeSource(map[string]any{
+		"/prefix/app/default/master/secrets": map[string]any{"db": map[string]any{"password": "x"}, "user": "admin"},
+	})
+	s.cache = newCache(time.Minute)
+
+	secrets, e := s.listSecrets(exactFilter([]string{"app", "app"}, nil, nil))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if names := groupSecretNames(secrets)["app"]["default"]["master"]; len(names) != 2 || names[0] != "db.password" || names[1] != "user" {
+		t.Errorf("unexpected secret names %v", names)
+	}
+	if len(s.cache.values) != 0 || len(s.cache.names) != 1 {
+		t.Errorf("expected listings to only cache names, got %v and %v", s.cache.values, s.cache.names)
+	}
+}
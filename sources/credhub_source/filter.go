@@ -0,0 +1,146 @@
+package credhub_source
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const (
+	// RegexPrefix marks a filter value as a regular expression, like apps=~^payments-(eu|us)$. Values containing *, ?
+	// or [ are globs, like apps=payments-*, and any other value is matched exactly.
+	RegexPrefix = "~"
+
+	InvalidFilterError = csn.ErrorF("invalid filter %s : %v")
+)
+
+type matcher func(string) bool
+
+// secretsFilter selects secrets by app, profile, label and key name. A nil list of matchers matches everything.
+type secretsFilter struct {
+	apps     []matcher
+	profiles []matcher
+	labels   []matcher
+	keys     []matcher
+}
+
+// exactFilter creates a filter matching exactly the given apps, profiles and labels
+func exactFilter(apps, profiles, labels []string) secretsFilter {
+	exact := func(values []string) []matcher {
+		var result []matcher
+		for _, value := range values {
+			value := value
+			result = append(result, func(s string) bool { return s == value })
+		}
+		return result
+	}
+	return secretsFilter{apps: exact(apps), profiles: exact(profiles), labels: exact(labels)}
+}
+
+// parseMatchers creates the matchers for a list of exact, glob or regex filter values
+func parseMatchers(values []string) ([]matcher, error) {
+	var result []matcher
+	for _, value := range values {
+		if expression, isRegex := strings.CutPrefix(value, RegexPrefix); isRegex {
+			regex, e := regexp.Compile(expression)
+			if e != nil {
+				return nil, InvalidFilterError.WithValues(value, e)
+			}
+			result = append(result, regex.MatchString)
+		} else if strings.ContainsAny(value, "*?[") {
+			if _, e := path.Match(value, ""); e != nil {
+				return nil, InvalidFilterError.WithValues(value, e)
+			}
+			pattern := value
+			result = append(result, func(s string) bool {
+				matched, _ := path.Match(pattern, s)
+				return matched
+			})
+		} else {
+			exact := value
+			result = append(result, func(s string) bool { return s == exact })
+		}
+	}
+	return result, nil
+}
+
+func matchesAny(matchers []matcher, value string) bool {
+	if matchers == nil {
+		return true
+	}
+	for _, matches := range matchers {
+		if matches(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCredentials returns the credentials matching the filter, sorted by app, profile and label
+func (ci *credentialsIndex) matchCredentials(filter secretsFilter) []secret {
+	var result []secret
+	for app, profiles := range *ci {
+		if !matchesAny(filter.apps, app) {
+			continue
+		}
+		for profile, labels := range profiles {
+			if !matchesAny(filter.profiles, profile) {
+				continue
+			}
+			for label, credential := range labels {
+				if matchesAny(filter.labels, label) {
+					result = append(result, secret{credential, app, profile, label})
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.app != b.app {
+			return a.app < b.app
+		} else if a.profile != b.profile {
+			return a.profile < b.profile
+		}
+		return a.label < b.label
+	})
+	return result
+}
+
+// pageOf returns the given 1-based page of items, or all items when size is 0
+func pageOf[T any](items []T, page, size int) []T {
+	if size <= 0 {
+		return items
+	}
+	start := (page - 1) * size
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// groupSecretNames groups secret names by app, profile and label
+func groupSecretNames(names []domain.SecretName) map[string]map[string]map[string][]string {
+	result := make(map[string]map[string]map[string][]string)
+	for _, name := range names {
+		appSecrets := result[name.App]
+		if appSecrets == nil {
+			appSecrets = make(map[string]map[string][]string)
+			result[name.App] = appSecrets
+		}
+		profileSecrets := appSecrets[name.Profile]
+		if profileSecrets == nil {
+			profileSecrets = make(map[string][]string)
+			appSecrets[name.Profile] = profileSecrets
+		}
+		profileSecrets[name.Label] = append(profileSecrets[name.Label], name.Name)
+	}
+	return result
+}
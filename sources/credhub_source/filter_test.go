@@ -0,0 +1,60 @@
+package credhub_source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestListSecretsFilters(t *testing.T) {
+	s, _ := newFakeSource(map[string]any{
+		"/prefix/payments-eu/default/master/secrets": map[string]any{"db.password": "x", "user": "u"},
+		"/prefix/payments-us/prod/master/secrets":    map[string]any{"api.password": "y"},
+		"/prefix/orders/default/master/secrets":      map[string]any{"db.password": "z"},
+	})
+
+	list := func(apps, profiles, keys []string) []domain.SecretName {
+		filter := secretsFilter{}
+		var e error
+		if filter.apps, e = parseMatchers(apps); e != nil {
+			t.Fatal(e)
+		}
+		if filter.profiles, e = parseMatchers(profiles); e != nil {
+			t.Fatal(e)
+		}
+		if filter.keys, e = parseMatchers(keys); e != nil {
+			t.Fatal(e)
+		}
+		names, e := s.listSecrets(filter)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return names
+	}
+
+	expected := []domain.SecretName{
+		{App: "payments-eu", Profile: "default", Label: "master", Name: "db.password"},
+		{App: "payments-us", Profile: "prod", Label: "master", Name: "api.password"},
+	}
+	if names := list([]string{"payments-*"}, nil, []string{"*password*"}); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	if names := list([]string{"~^pay.*-us$", "orders"}, nil, nil); len(names) != 2 || names[0].App != "orders" || names[1].App != "payments-us" {
+		t.Errorf("unexpected regex listing %v", names)
+	}
+	if names := list(nil, []string{"default"}, nil); len(names) != 3 {
+		t.Errorf("unexpected profile listing %v", names)
+	}
+	if _, e := parseMatchers([]string{"~("}); !InvalidFilterError.IsKindOf(e) {
+		t.Errorf("expected invalid regex to be rejected, got %v", e)
+	}
+
+	all := list(nil, nil, nil)
+	if page := pageOf(all, 2, 3); len(page) != 1 || page[0] != all[3] {
+		t.Errorf("unexpected page %v", page)
+	}
+	if page := pageOf(all, 3, 3); len(page) != 0 {
+		t.Errorf("expected empty page past the end, got %v", page)
+	}
+}
@@ -0,0 +1,195 @@
+package credhub_source
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/util"
+)
+
+const (
+	// GenerateProperty marks generation requests, like {"generate": "password", "length": 32}. The reserved form
+	// {"$generate": "password"} is also accepted, for nested secrets which are not generation requests to be unambiguous.
+	GenerateProperty         = "generate"
+	ReservedGenerateProperty = "$generate"
+
+	// CaParameter names the credhub certificate signing generated certificates
+	CaParameter = "ca"
+
+	InvalidGenerationSpecError       = csn.ErrorF("secret %s must be a generation request like {\"generate\": \"password\"}")
+	InvalidGenerationParametersError = csn.ErrorF("invalid %s generation parameters : %s")
+	UnknownRotatedSecretError        = csn.ErrorF("secret %s doesn't exist for app %s, profile %s and label %s")
+)
+
+// generationSpec returns the credential type and the generation parameters when the value requests a generated secret,
+// like {"generate": "password", "length": 32}. The parameters are passed as-is to credhub.
+func generationSpec(value any) (string, map[string]any, bool) {
+	if spec, isMap := value.(map[string]any); isMap {
+		for _, property := range []string{ReservedGenerateProperty, GenerateProperty} {
+			if credentialType, isString := spec[property].(string); isString {
+				parameters := make(map[string]any)
+				for k, v := range spec {
+					if k != GenerateProperty && k != ReservedGenerateProperty {
+						parameters[k] = v
+					}
+				}
+				return credentialType, parameters, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// generateSecrets replaces all generation requests in the secrets, at any depth, with values generated by credhub,
+// returning the dotted names of the generated secrets
+func (s *source) generateSecrets(secrets map[string]any) (map[string]any, []string, error) {
+	var generated []string
+	var generate func(prefix string, secrets map[string]any) (map[string]any, error)
+	generate = func(prefix string, secrets map[string]any) (map[string]any, error) {
+		result := make(map[string]any, len(secrets))
+		for key, value := range secrets {
+			if credentialType, parameters, isSpec := generationSpec(value); isSpec {
+				generatedValue, e := s.generateValue(credentialType, parameters)
+				if e != nil {
+					l.Errorf("Failed to generate %s secret %s : %v", credentialType, prefix+key, e)
+					return nil, e
+				}
+				result[key] = generatedValue
+				generated = append(generated, prefix+key)
+			} else if nested, isMap := value.(map[string]any); isMap {
+				nestedResult, e := generate(prefix+key+".", nested)
+				if e != nil {
+					return nil, e
+				}
+				result[key] = nestedResult
+			} else {
+				result[key] = value
+			}
+		}
+		return result, nil
+	}
+
+	result, e := generate("", secrets)
+	sort.Strings(generated)
+	return result, generated, e
+}
+
+// generateValue has credhub generate a value in a transient credential, which is deleted once the value is read. The
+// generated value is then stored, and versioned, with the other secrets. Certificates can only be signed by the
+// certificates of the source.
+func (s *source) generateValue(credentialType string, parameters map[string]any) (any, error) {
+	if ca, found := parameters[CaParameter]; found {
+		if name, isString := ca.(string); !isString || !strings.HasPrefix(name, s.prefix) || strings.Contains(name, "..") {
+			return nil, InvalidGenerationParametersError.WithValues(credentialType, fmt.Sprintf("ca must be a credential under %s", s.prefix))
+		}
+	}
+
+	suffix := make([]byte, 16)
+	if _, e := rand.Read(suffix); e != nil {
+		return nil, e
+	}
+	name := fmt.Sprintf("%sgenerated/%s", s.prefix, hex.EncodeToString(suffix))
+
+	defer func() {
+		if e := s.client.DeleteByName(name); e != nil {
+			l.Errorf("Failed to delete transient credential %s : %v", name, e)
+		}
+	}()
+	credential, e := s.client.GenerateByName(name, credentialType, parameters)
+	if e != nil {
+		return nil, e
+	}
+	return credential.Value, nil
+}
+
+// rotateSecrets regenerates existing secrets for all the combinations of apps, profiles and labels and notifies the
+// rotation. All keys must be generation requests and must already exist.
+func (s *source) rotateSecrets(apps []string, profiles []string, labels []string, secrets map[string]any) ([]domain.RotatedSecrets, error) {
+	apps, profiles, labels = defaultTargets(apps, profiles, labels)
+	for key, value := range secrets {
+		if _, _, isSpec := generationSpec(value); !isSpec {
+			return nil, InvalidGenerationSpecError.WithValues(key)
+		}
+	}
+
+	existingCredentials, e := s.getExistingCredentials()
+	if e != nil {
+		return nil, e
+	}
+
+	var rotated []domain.RotatedSecrets
+	var credentials []map[string]any
+	for _, app := range apps {
+		for _, profile := range profiles {
+			for _, label := range labels {
+				credentialName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, app, profile, label)
+				var existing map[string]any
+				if existingCredentials.contains(app, profile, label) {
+					if existing, e = s.client.GetJsonByName(credentialName); e != nil {
+						l.Errorf("Unable to read credentials %s\n", credentialName)
+						return nil, e
+					}
+				}
+				existing = flattenSecrets("", existing)
+				keys := make([]string, 0, len(secrets))
+				for key := range secrets {
+					if _, found := existing[key]; !found && !hasNested(existing, key) {
+						return nil, UnknownRotatedSecretError.WithValues(key, app, profile, label)
+					}
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				rotated = append(rotated, domain.RotatedSecrets{Source: s.name, App: app, Profile: profile, Label: label, Keys: keys})
+				credentials = append(credentials, existing)
+			}
+		}
+	}
+
+	// each credential gets its own generated values, written as a single new version
+	for i, rotation := range rotated {
+		generated, _, e := s.generateSecrets(secrets)
+		if e != nil {
+			return nil, e
+		}
+		// the previous values are dropped first, including the properties of a previously generated structured secret
+		credential, _ := deleteSecrets(credentials[i], rotation.Keys)
+		credential = mergeSecrets(credential, flattenSecrets("", generated))
+		credentialName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, rotation.App, rotation.Profile, rotation.Label)
+		if e = s.setCredential(credentialName, credential); e != nil {
+			l.Errorf("Failed to write credentials: %v\n", e)
+			return nil, e
+		}
+		l.Infof("Rotated secrets %v for app %s, profile %s and label %s", rotation.Keys, rotation.App, rotation.Profile, rotation.Label)
+		s.notify(rotation)
+	}
+	return rotated, nil
+}
+
+func hasNested(secrets map[string]any, key string) bool {
+	for existingKey := range secrets {
+		if strings.HasPrefix(existingKey, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// notify posts the rotation to the configured notification url, if any, so the affected apps can refresh
+func (s *source) notify(rotation domain.RotatedSecrets) {
+	if s.notificationUrl == nil {
+		return
+	}
+	go func() {
+		if content, e := json.Marshal(rotation); e != nil {
+			l.Errorf("Unable to encode rotation notification : %v", e)
+		} else if _, e = util.Request(*s.notificationUrl).Sending("application/json").PostContent(content); e != nil {
+			l.Errorf("Failed to notify rotation of secrets for app %s, profile %s and label %s : %v", rotation.App, rotation.Profile, rotation.Label, e)
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package credhub_source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddGeneratedSecrets(t *testing.T) {
+	s, client := newFakeSource(map[string]any{})
+	secrets := map[string]any{
+		"db.password": map[string]any{"generate": "password", "length": 32},
+		"api":         map[string]any{"key": map[string]any{ReservedGenerateProperty: "password"}},
+		"user":        "admin",
+	}
+
+	if e := s.addSecrets([]string{"app"}, nil, nil, secrets); e != nil {
+		t.Fatal(e)
+	}
+
+	stored := client.credentials["/prefix/app/default/master/secrets"].(map[string]any)
+	if stored["db.password"] == nil || stored["api.key"] == nil || stored["user"] != "admin" || len(stored) != 3 {
+		t.Errorf("expected the generated values to be stored with the other secrets, got %v", stored)
+	}
+	if len(client.parameters) != 2 {
+		t.Fatalf("expected credhub to generate 2 values, got %v", client.parameters)
+	}
+	if len(client.credentials) != 1 {
+		t.Errorf("expected transient generated credentials to be deleted, got %v", client.credentials)
+	}
+}
+
+func TestGenerationCa(t *testing.T) {
+	s, client := newFakeSource(map[string]any{})
+
+	certificate := map[string]any{"generate": "certificate", "common_name": "app", "ca": "/prefix/ca"}
+	if e := s.addSecrets([]string{"app"}, nil, nil, map[string]any{"tls": certificate}); e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(client.parameters[0], map[string]any{"common_name": "app", "ca": "/prefix/ca"}) {
+		t.Errorf("expected the parameters to be passed to credhub, got %v", client.parameters[0])
+	}
+
+	for _, ca := range []any{"/platform/ca", "/prefix/../platform/ca", 1} {
+		certificate["ca"] = ca
+		if e := s.addSecrets([]string{"app"}, nil, nil, map[string]any{"tls": certificate}); !InvalidGenerationParametersError.IsKindOf(e) {
+			t.Errorf("expected ca %v outside of the source to be rejected, got %v", ca, e)
+		}
+	}
+	if len(client.parameters) != 1 {
+		t.Errorf("expected rejected certificates not to be generated")
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	s, client := newFakeSource(map[string]any{
+		"/prefix/app/dev/master/secrets":  map[string]any{"db.password": "old", "user": "admin"},
+		"/prefix/app/prod/master/secrets": map[string]any{"db.password": "old"},
+	})
+	rotation := map[string]any{"db.password": map[string]any{"generate": "password"}}
+
+	rotated, e := s.rotateSecrets([]string{"app"}, []string{"dev", "prod"}, nil, rotation)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(rotated) != 2 || !reflect.DeepEqual(rotated[0].Keys, []string{"db.password"}) {
+		t.Errorf("unexpected rotation report %v", rotated)
+	}
+	dev := client.credentials["/prefix/app/dev/master/secrets"].(map[string]any)
+	prod := client.credentials["/prefix/app/prod/master/secrets"].(map[string]any)
+	if dev["db.password"] == "old" || prod["db.password"] == "old" || dev["db.password"] == prod["db.password"] || dev["user"] != "admin" {
+		t.Errorf("expected distinct regenerated passwords, got %v and %v", dev, prod)
+	}
+
+	if _, e = s.rotateSecrets([]string{"app"}, []string{"dev"}, nil, map[string]any{"unknown": map[string]any{"generate": "password"}}); !UnknownRotatedSecretError.IsKindOf(e) {
+		t.Errorf("expected unknown secrets not to be rotated, got %v", e)
+	}
+	if _, e = s.rotateSecrets([]string{"app"}, []string{"dev"}, nil, map[string]any{"user": "plain"}); !InvalidGenerationSpecError.IsKindOf(e) {
+		t.Errorf("expected plain values to be rejected, got %v", e)
+	}
+}
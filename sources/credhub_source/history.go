@@ -0,0 +1,119 @@
+package credhub_source
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+)
+
+const (
+	DefaultHistoryVersions = 10
+	MaxHistoryVersions     = 100
+
+	UnknownVersionError = csn.ErrorF("version %s is not a version of %s")
+)
+
+// secretsHistory lists the most recent versions of the secrets matching the apps, profiles and labels, each version
+// with the names of the keys it added, changed or removed
+func (s *source) secretsHistory(apps []string, profiles []string, labels []string, versions int) ([]domain.SecretHistory, error) {
+	existingCredentials, e := s.getExistingCredentials()
+	if e != nil {
+		return nil, e
+	}
+
+	result := make([]domain.SecretHistory, 0)
+	for _, credReference := range existingCredentials.filterCredentials(apps, profiles, labels) {
+		// one extra version is read so the changes of the oldest listed version can be determined
+		credentialVersions, e := s.client.GetJsonVersionsByName(credReference.name, versions+1)
+		if e != nil {
+			l.Errorf("Failed to retrieve versions of %s : %v", credReference.name, e)
+			return nil, e
+		}
+
+		history := domain.SecretHistory{App: credReference.app, Profile: credReference.profile, Label: credReference.label}
+		for i := 0; i < len(credentialVersions) && i < versions; i++ {
+			version := domain.SecretVersion{Id: credentialVersions[i].Id, CreatedAt: credentialVersions[i].VersionCreatedAt}
+			var previous map[string]any
+			if i+1 < len(credentialVersions) {
+				previous = credentialVersions[i+1].Value
+			}
+			version.Added, version.Changed, version.Removed = changedKeys(previous, credentialVersions[i].Value)
+			history.Versions = append(history.Versions, version)
+		}
+		result = append(result, history)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.App != b.App {
+			return a.App < b.App
+		} else if a.Profile != b.Profile {
+			return a.Profile < b.Profile
+		}
+		return a.Label < b.Label
+	})
+	return result, nil
+}
+
+// rollback restores the secrets of an app/profile/label to the given version, replacing the current secrets through the
+// same path as added secrets
+func (s *source) rollback(app, profile, label, versionId string) error {
+	credentialName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, app, profile, label)
+	version, e := s.client.GetJsonCredentialById(versionId)
+	if e != nil {
+		l.Errorf("Failed to retrieve version %s of %s : %v", versionId, credentialName, e)
+		return UnknownVersionError.WithValues(versionId, credentialName)
+	}
+	if version.Name != credentialName {
+		return UnknownVersionError.WithValues(versionId, credentialName)
+	}
+
+	l.Infof("Rolling back %s to version %s created at %v", credentialName, versionId, version.VersionCreatedAt)
+	return s.writeSecrets([]string{app}, []string{profile}, []string{label}, version.Value, false)
+}
+
+// changedKeys compares two versions of secrets and returns the dotted names of the keys that were added, changed and
+// removed from the previous to the current version
+func changedKeys(previous, current map[string]any) (added, changed, removed []string) {
+	previousValues := make(map[string]any)
+	currentValues := make(map[string]any)
+	collectValues("", previous, previousValues)
+	collectValues("", current, currentValues)
+
+	for key, value := range currentValues {
+		if previousValue, found := previousValues[key]; !found {
+			added = append(added, key)
+		} else if !reflect.DeepEqual(previousValue, value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previousValues {
+		if _, found := currentValues[key]; !found {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return
+}
+
+func collectValues(prefix string, secrets map[string]any, result map[string]any) {
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if nested, isMap := secrets[key].(map[string]any); isMap && len(nested) > 0 {
+			collectValues(prefix+key+".", nested, result)
+		} else {
+			result[prefix+key] = secrets[key]
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package credhub_source
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rabobank/credhub-client"
+)
+
+func TestChangedKeys(t *testing.T) {
+	previous := map[string]any{
+		"db":    map[string]any{"user": "admin", "password": "old"},
+		"token": "abc",
+	}
+	current := map[string]any{
+		"db":     map[string]any{"user": "admin", "password": "new"},
+		"apiKey": "xyz",
+	}
+
+	added, changed, removed := changedKeys(previous, current)
+	if !reflect.DeepEqual(added, []string{"apiKey"}) {
+		t.Errorf("unexpected added keys %v", added)
+	}
+	if !reflect.DeepEqual(changed, []string{"db.password"}) {
+		t.Errorf("unexpected changed keys %v", changed)
+	}
+	if !reflect.DeepEqual(removed, []string{"token"}) {
+		t.Errorf("unexpected removed keys %v", removed)
+	}
+
+	if added, changed, removed = changedKeys(nil, current); len(added) != 3 || changed != nil || removed != nil {
+		t.Errorf("expected all keys of the first version to be added, got %v %v %v", added, changed, removed)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	s, client := newFakeSource(map[string]any{
+		"/prefix/app/dev/master/secrets":  map[string]any{"db.password": "bad", "token": "t"},
+		"/prefix/app/dev/master/metadata": map[string]any{"db.password": map[string]any{"owner": "team-a"}, "token": map[string]any{"owner": "team-b"}},
+	})
+	client.versions = map[string]*credhub.Credential[map[string]any]{
+		"v1":    {Id: "v1", Name: "/prefix/app/dev/master/secrets", Value: map[string]any{"db.password": "good"}},
+		"other": {Id: "other", Name: "/prefix/other/dev/master/secrets", Value: map[string]any{"db.password": "other"}},
+	}
+	// the cached secrets and metadata must be refreshed by the rollback
+	s.cache = newCache(time.Minute)
+	if _, e := s.getMetadata("/prefix/app/dev/master/secrets"); e != nil {
+		t.Fatal(e)
+	}
+
+	if e := s.rollback("app", "dev", "master", "other"); !UnknownVersionError.IsKindOf(e) {
+		t.Errorf("expected versions of other secrets to be rejected, got %v", e)
+	}
+	if e := s.rollback("app", "dev", "master", "missing"); !UnknownVersionError.IsKindOf(e) {
+		t.Errorf("expected unknown versions to be rejected, got %v", e)
+	}
+
+	if e := s.rollback("app", "dev", "master", "v1"); e != nil {
+		t.Fatal(e)
+	}
+	if secrets := client.credentials["/prefix/app/dev/master/secrets"]; !reflect.DeepEqual(secrets, map[string]any{"db.password": "good"}) {
+		t.Errorf("expected the secrets to be replaced by the version, got %v", secrets)
+	}
+	metadata, e := s.getMetadata("/prefix/app/dev/master/secrets")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(metadata) != 1 || metadata["db.password"].Owner != "team-a" {
+		t.Errorf("expected the metadata of the keys removed by the rollback to be dropped, got %v", metadata)
+	}
+}
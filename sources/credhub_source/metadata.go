@@ -0,0 +1,255 @@
+package credhub_source
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/util"
+)
+
+const (
+	// MetadataProperty is the property of the secrets written with AddSecrets holding the metadata of the keys
+	MetadataProperty = "$metadata"
+
+	DefaultExpiringWithin = 30 * 24 * time.Hour
+
+	InvalidMetadataError = csn.ErrorF("invalid metadata for %s, metadata can only be provided for the keys being written")
+)
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse("" +
+	"                    <div class=\"source-report-group\">\n" +
+	"                        <h3 class=\"title\">Secrets expiring within {{.Days}} days</h3>\n" +
+	"{{if .Error}}" +
+	"                        <div class=\"error\">{{.Error}}</div>\n" +
+	"{{end}}" +
+	"{{range .Secrets}}" +
+	"                        <div class=\"credhub-secret\">\n" +
+	"                            <div class=\"source-report-line\">\n" +
+	"                                <span class=\"label\">Secret</span>&nbsp;<span class=\"value\">{{.App}}/{{.Profile}}/{{.Label}} {{.Key}}</span>\n" +
+	"                            </div>\n" +
+	"                            <div class=\"source-report-line\">\n" +
+	"                                <span class=\"label\">Expires</span>&nbsp;<span class=\"value{{if .Expired}} error{{end}}\">{{.Metadata.ExpiresAt}}</span>\n" +
+	"                            </div>\n" +
+	"                            <div class=\"source-report-line\">\n" +
+	"                                <span class=\"label\">Owner</span>&nbsp;<span class=\"value\">{{.Metadata.Owner}}</span>\n" +
+	"                            </div>\n" +
+	"{{if .Metadata.Ticket}}" +
+	"                            <div class=\"source-report-line\">\n" +
+	"                                <span class=\"label\">Ticket</span>&nbsp;<span class=\"value\">{{.Metadata.Ticket}}</span>\n" +
+	"                            </div>\n" +
+	"{{end}}" +
+	"                        </div>\n" +
+	"{{else}}" +
+	"                        <div class=\"source-report-line\">No secrets expiring.</div>\n" +
+	"{{end}}" +
+	"                    </div>\n"))
+
+type expiringReport struct {
+	Days    int
+	Error   string
+	Secrets []domain.ExpiringSecret
+}
+
+func metadataName(secretsName string) string {
+	return strings.TrimSuffix(secretsName, "secrets") + "metadata"
+}
+
+// extractMetadata removes the metadata property from the secrets being written, returning the metadata by canonical key
+func extractMetadata(secrets map[string]any) (map[string]any, map[string]domain.SecretMetadata, error) {
+	value, found := secrets[MetadataProperty]
+	if !found {
+		return secrets, nil, nil
+	}
+
+	result := make(map[string]any, len(secrets)-1)
+	for k, v := range secrets {
+		if k != MetadataProperty {
+			result[k] = v
+		}
+	}
+
+	var metadata map[string]domain.SecretMetadata
+	if content, e := json.Marshal(value); e != nil {
+		return nil, nil, InvalidMetadataError.WithValues(MetadataProperty)
+	} else if e = json.Unmarshal(content, &metadata); e != nil {
+		return nil, nil, InvalidMetadataError.WithValues(MetadataProperty)
+	}
+
+	keys := flattenSecrets("", result)
+	for key := range metadata {
+		if _, found := keys[key]; !found && !hasNested(keys, key) {
+			return nil, nil, InvalidMetadataError.WithValues(key)
+		}
+	}
+	return result, metadata, nil
+}
+
+// readMetadata reads the metadata credential, considering a missing credential as having no metadata
+func (s *source) readMetadata(name string) (map[string]any, error) {
+	if metadata, e := util.GetJsonIfExists(s.client, name); e != nil {
+		return nil, e
+	} else if metadata == nil {
+		return make(map[string]any), nil
+	} else {
+		return metadata, nil
+	}
+}
+
+// getMetadata reads the metadata of the keys of a secrets credential through the source cache
+func (s *source) getMetadata(secretsName string) (map[string]domain.SecretMetadata, error) {
+	metadata, e := s.cache.getValue(metadataName(secretsName), s.readMetadata)
+	if e != nil {
+		return nil, e
+	}
+	return decodeMetadata(metadata), nil
+}
+
+func decodeMetadata(metadata map[string]any) map[string]domain.SecretMetadata {
+	result := make(map[string]domain.SecretMetadata, len(metadata))
+	for key, value := range metadata {
+		var keyMetadata domain.SecretMetadata
+		if content, e := json.Marshal(value); e == nil && json.Unmarshal(content, &keyMetadata) == nil {
+			result[key] = keyMetadata
+		}
+	}
+	return result
+}
+
+// staleMetadata returns the keys with metadata which are not part of the secrets replacing the existing ones
+func (s *source) staleMetadata(secretsName string, secrets map[string]any) ([]string, error) {
+	existing, e := s.readMetadata(metadataName(secretsName))
+	if e != nil {
+		l.Errorf("Unable to read metadata of %s : %v", secretsName, e)
+		return nil, e
+	}
+	var stale []string
+	for key := range existing {
+		if _, found := secrets[key]; !found && !hasNested(secrets, key) {
+			stale = append(stale, key)
+		}
+	}
+	return stale, nil
+}
+
+// updateMetadata merges the metadata of the given keys into the metadata credential of the secrets and drops the
+// metadata of the deleted keys
+func (s *source) updateMetadata(secretsName string, metadata map[string]domain.SecretMetadata, deleted []string) error {
+	name := metadataName(secretsName)
+	existing, e := s.readMetadata(name)
+	if e != nil {
+		l.Errorf("Unable to read metadata %s : %v", name, e)
+		return e
+	}
+
+	existing, removed := deleteSecrets(existing, deleted)
+	if len(metadata) == 0 && !removed {
+		return nil
+	}
+	for key, keyMetadata := range metadata {
+		existing[key] = keyMetadata
+	}
+
+	// stored as plain json values
+	var value map[string]any
+	if content, e := json.Marshal(existing); e != nil {
+		return e
+	} else if e = json.Unmarshal(content, &value); e != nil {
+		return e
+	}
+	if e = s.setCredential(name, value); e != nil {
+		l.Errorf("Failed to write metadata %s : %v", name, e)
+		return e
+	}
+	return nil
+}
+
+// withMetadata groups secret names by app, profile and label like listings do, adding the metadata of each key
+func (s *source) withMetadata(secretNames []domain.SecretName) map[string]map[string]map[string][]domain.SecretEntry {
+	var names []string
+	for _, name := range secretNames {
+		names = append(names, fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, name.App, name.Profile, name.Label))
+	}
+	metadata := fetchAll(names, s.getMetadata)
+
+	result := make(map[string]map[string]map[string][]domain.SecretEntry)
+	for i, name := range secretNames {
+		if result[name.App] == nil {
+			result[name.App] = make(map[string]map[string][]domain.SecretEntry)
+		}
+		if result[name.App][name.Profile] == nil {
+			result[name.App][name.Profile] = make(map[string][]domain.SecretEntry)
+		}
+		entry := domain.SecretEntry{Name: name.Name}
+		if keysMetadata := metadata[names[i]]; keysMetadata.e != nil {
+			l.Errorf("Failed to retrieve metadata of %s : %v", names[i], keysMetadata.e)
+		} else if keyMetadata, found := keysMetadata.value[name.Name]; found {
+			entry.Metadata = &keyMetadata
+		}
+		result[name.App][name.Profile][name.Label] = append(result[name.App][name.Profile][name.Label], entry)
+	}
+	return result
+}
+
+// expiringSecrets lists the secrets which expire within the given duration, including the already expired ones, the
+// first to expire first
+func (s *source) expiringSecrets(within time.Duration) ([]domain.ExpiringSecret, error) {
+	existingCredentials, e := s.getExistingCredentials()
+	if e != nil {
+		return nil, e
+	}
+
+	relevantCredentials := existingCredentials.filterCredentials(nil, nil, nil)
+	metadata := fetchAll(credentialNames(relevantCredentials), s.getMetadata)
+
+	now := time.Now()
+	limit := now.Add(within)
+	result := make([]domain.ExpiringSecret, 0)
+	for _, credReference := range relevantCredentials {
+		keysMetadata := metadata[credReference.name]
+		if keysMetadata.e != nil {
+			// one unreadable credential doesn't hide the expiring secrets of all the others
+			l.Errorf("Failed to retrieve metadata of %s : %v", credReference.name, keysMetadata.e)
+			continue
+		}
+		for key, keyMetadata := range keysMetadata.value {
+			if keyMetadata.ExpiresAt != nil && keyMetadata.ExpiresAt.Before(limit) {
+				result = append(result, domain.ExpiringSecret{
+					App:      credReference.app,
+					Profile:  credReference.profile,
+					Label:    credReference.label,
+					Key:      key,
+					Expired:  keyMetadata.ExpiresAt.Before(now),
+					Metadata: keyMetadata,
+				})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Metadata.ExpiresAt.Before(*result[j].Metadata.ExpiresAt)
+	})
+	return result, nil
+}
+
+func (s *source) DashboardReport() *string {
+	report := expiringReport{Days: int(DefaultExpiringWithin.Hours() / 24)}
+	var e error
+	if report.Secrets, e = s.expiringSecrets(DefaultExpiringWithin); e != nil {
+		report.Error = fmt.Sprintf("Unable to read secrets metadata : %v", e)
+	}
+
+	buffer := &bytes.Buffer{}
+	if e = dashboardTemplate.Execute(buffer, report); e != nil {
+		l.Errorf("Failure to execute the template : %v", e)
+		return nil
+	}
+	result := buffer.String()
+	return &result
+}
@@ -0,0 +1,90 @@
+package credhub_source
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretsMetadata(t *testing.T) {
+	s, client := newFakeSource(map[string]any{})
+	soon := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	later := time.Now().Add(90 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	secrets := map[string]any{
+		"db":    map[string]any{"password": "x"},
+		"token": "t",
+		MetadataProperty: map[string]any{
+			"db.password": map[string]any{"owner": "team-a", "expiresAt": soon, "ticket": "CHG-1"},
+			"token":       map[string]any{"owner": "team-b", "expiresAt": later},
+		},
+	}
+	if e := s.addSecrets([]string{"app"}, nil, nil, secrets); e != nil {
+		t.Fatal(e)
+	}
+	if stored := client.credentials["/prefix/app/default/master/secrets"].(map[string]any); len(stored) != 2 {
+		t.Errorf("expected metadata not to be stored with the secrets, got %v", stored)
+	}
+
+	names, e := s.listSecrets(exactFilter([]string{"app"}, nil, nil))
+	if e != nil {
+		t.Fatal(e)
+	}
+	entries := s.withMetadata(names)["app"]["default"]["master"]
+	if len(entries) != 2 || entries[0].Name != "db.password" || entries[0].Metadata == nil || entries[0].Metadata.Owner != "team-a" {
+		t.Errorf("unexpected listing %v", entries)
+	}
+
+	expiring, e := s.expiringSecrets(DefaultExpiringWithin)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(expiring) != 1 || expiring[0].Key != "db.password" || expiring[0].Expired {
+		t.Errorf("unexpected expiring secrets %v", expiring)
+	}
+	if report := s.DashboardReport(); report == nil || !strings.Contains(*report, "CHG-1") {
+		t.Errorf("expected expiring secret on the dashboard")
+	}
+
+	if e = s.deleteSecrets([]string{"app"}, nil, nil, []string{"db"}); e != nil {
+		t.Fatal(e)
+	}
+	if metadata := client.credentials["/prefix/app/default/master/metadata"].(map[string]any); len(metadata) != 1 || metadata["token"] == nil {
+		t.Errorf("expected metadata of deleted keys to be dropped, got %v", metadata)
+	}
+
+	invalid := map[string]any{"a": "1", MetadataProperty: map[string]any{"b": map[string]any{"owner": "x"}}}
+	if e = s.addSecrets([]string{"app"}, nil, nil, invalid); !InvalidMetadataError.IsKindOf(e) {
+		t.Errorf("expected metadata of keys not written to be rejected, got %v", e)
+	}
+}
+
+func TestParseWithin(t *testing.T) {
+	if within, e := parseWithin("30d"); e != nil || within != 30*24*time.Hour {
+		t.Errorf("unexpected duration %v %v", within, e)
+	}
+	if within, e := parseWithin("12h"); e != nil || within != 12*time.Hour {
+		t.Errorf("unexpected duration %v %v", within, e)
+	}
+	if _, e := parseWithin("xd"); e == nil {
+		t.Errorf("expected invalid days to be rejected")
+	}
+}
+
+func TestExpiringSecretsWithUnreadableMetadata(t *testing.T) {
+	soon := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	s, client := newFakeSource(map[string]any{
+		"/prefix/app/default/master/secrets":    map[string]any{"token": "t"},
+		"/prefix/app/default/master/metadata":   map[string]any{"token": map[string]any{"expiresAt": soon}},
+		"/prefix/other/default/master/secrets":  map[string]any{"token": "t"},
+		"/prefix/other/default/master/metadata": map[string]any{"token": map[string]any{"expiresAt": soon}},
+	})
+	client.failing = map[string]bool{"/prefix/other/default/master/metadata": true}
+
+	expiring, e := s.expiringSecrets(DefaultExpiringWithin)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(expiring) != 1 || expiring[0].App != "app" {
+		t.Errorf("expected the expiring secrets with readable metadata, got %v", expiring)
+	}
+}
@@ -3,13 +3,31 @@ package credhub_source
 import (
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
 	"github.com/gomatbase/go-we/util"
+	"github.com/rabobank/config-hub/audit"
 	"github.com/rabobank/config-hub/domain"
 )
 
+// targetSource returns the credhub source named in the request path, or the first (highest precedence) credhub source
+// when no source is named
+func targetSource(r we.RequestScope) (*source, error) {
+	if name, found := r.LookupVar("source"); found {
+		if s := sourcesByName[name]; s != nil {
+			return s, nil
+		}
+	} else if len(credhubSources) > 0 {
+		return credhubSources[0], nil
+	}
+	return nil, events.NotFoundError
+}
+
 func getParameters(r we.RequestScope) (apps, profiles, labels []string) {
 	apps = fromListParameter(r.Parameter("apps"))
 	profiles = fromListParameter(r.Parameter("profiles"))
@@ -25,44 +43,84 @@ func fromListParameter(parameter string) []string {
 	return strings.Split(parameter, ",")
 }
 
+// getFilter reads the listing filters, where apps, profiles, labels and keys may be exact values, globs or regular
+// expressions
+func getFilter(r we.RequestScope) (filter secretsFilter, e error) {
+	if filter.apps, e = parseMatchers(fromListParameter(r.Parameter("apps"))); e != nil {
+		return
+	}
+	if filter.profiles, e = parseMatchers(fromListParameter(r.Parameter("profiles"))); e != nil {
+		return
+	}
+	if filter.labels, e = parseMatchers(fromListParameter(r.Parameter("labels"))); e != nil {
+		return
+	}
+	filter.keys, e = parseMatchers(fromListParameter(r.Parameter("keys")))
+	return
+}
+
+// listSecretsPage lists the secret names matching the request filters, returning the requested page. The total number of
+// matching secrets is returned in the X-Total-Count header.
+func listSecretsPage(w we.ResponseWriter, r we.RequestScope) ([]domain.SecretName, *source, error) {
+	page, size := 1, 0
+	if parameter := r.Parameter("size"); len(parameter) > 0 {
+		var e error
+		if size, e = strconv.Atoi(parameter); e != nil || size < 1 {
+			return nil, nil, events.New(http.StatusBadRequest, "size must be a positive number")
+		}
+	}
+	if parameter := r.Parameter("page"); len(parameter) > 0 {
+		var e error
+		if page, e = strconv.Atoi(parameter); e != nil || page < 1 || size == 0 {
+			return nil, nil, events.New(http.StatusBadRequest, "page must be a positive number and requires a size")
+		}
+	}
+
+	if s, e := targetSource(r); e != nil {
+		return nil, nil, e
+	} else if filter, e := getFilter(r); e != nil {
+		return nil, nil, events.New(http.StatusBadRequest, e.Error())
+	} else if secretNames, e := s.listSecrets(filter); e != nil {
+		return nil, nil, e
+	} else {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(secretNames)))
+		return pageOf(secretNames, page, size), s, nil
+	}
+}
+
 func ListSecretsCompatible(w we.ResponseWriter, r we.RequestScope) error {
-	apps, profiles, labels := getParameters(r)
-	if secretNames, e := defaultSource.listSecrets(apps, profiles, labels); e != nil {
+	if secretNames, _, e := listSecretsPage(w, r); e != nil {
 		return e
 	} else {
-		// convert to old config-server format
-		var convertedNames []domain.SecretName
-		for app, profileSecrets := range secretNames {
-			for profile, labelSecrets := range profileSecrets {
-				for label, names := range labelSecrets {
-					for _, name := range names {
-						convertedNames = append(convertedNames, domain.SecretName{App: app, Profile: profile, Label: label, Name: name})
-					}
-				}
-			}
-		}
-		return util.ReplyJson(w, http.StatusOK, convertedNames)
+		// old config-server format
+		return util.ReplyJson(w, http.StatusOK, secretNames)
 	}
 }
 
 func ListSecrets(w we.ResponseWriter, r we.RequestScope) error {
-	apps, profiles, labels := getParameters(r)
-	if secretNames, e := defaultSource.listSecrets(apps, profiles, labels); e != nil {
+	if secretNames, s, e := listSecretsPage(w, r); e != nil {
 		return e
+	} else if r.Parameter("metadata") == "true" {
+		return util.ReplyJson(w, http.StatusOK, s.withMetadata(secretNames))
 	} else {
-		return util.ReplyJson(w, http.StatusOK, secretNames)
+		return util.ReplyJson(w, http.StatusOK, groupSecretNames(secretNames))
 	}
 }
 
 func AddSecrets(w we.ResponseWriter, r we.RequestScope) error {
 	apps, profiles, labels := getParameters(r)
-	fmt.Println("adding secrets for", apps, profiles, labels)
-	if secrets, e := util.ReadJsonBody[map[string]any](r); e != nil {
-		fmt.Println("error reading json body", e)
+	if s, e := targetSource(r); e != nil {
 		return e
-	} else if e = defaultSource.addSecrets(apps, profiles, labels, *secrets); e != nil {
+	} else if secrets, e := util.ReadJsonBody[map[string]any](r); e != nil {
 		return e
 	} else {
+		audit.Keys(r, secretKeys(*secrets))
+		if e = s.addSecrets(apps, profiles, labels, *secrets); e != nil {
+			if InvalidMetadataError.IsKindOf(e) || InvalidGenerationParametersError.IsKindOf(e) {
+				return events.New(http.StatusBadRequest, e.Error())
+			}
+			return e
+		}
 		w.WriteHeader(http.StatusAccepted)
 	}
 	return nil
@@ -70,12 +128,230 @@ func AddSecrets(w we.ResponseWriter, r we.RequestScope) error {
 
 func DeleteSecrets(w we.ResponseWriter, r we.RequestScope) error {
 	apps, profiles, labels := getParameters(r)
-	if secretNames, e := util.ReadJsonBody[[]string](r); e != nil {
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if secretNames, e := util.ReadJsonBody[[]string](r); e != nil {
+		return e
+	} else {
+		audit.Keys(r, *secretNames)
+		if e = s.deleteSecrets(apps, profiles, labels, *secretNames); e != nil {
+			return e
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return nil
+}
+
+func SecretsHistory(w we.ResponseWriter, r we.RequestScope) error {
+	apps, profiles, labels := getParameters(r)
+	versions := DefaultHistoryVersions
+	if parameter := r.Parameter("versions"); len(parameter) > 0 {
+		if value, e := strconv.Atoi(parameter); e != nil || value < 1 || value > MaxHistoryVersions {
+			return events.New(http.StatusBadRequest, fmt.Sprintf("versions must be a number between 1 and %d", MaxHistoryVersions))
+		} else {
+			versions = value
+		}
+	}
+
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if history, e := s.secretsHistory(apps, profiles, labels, versions); e != nil {
+		return e
+	} else {
+		return util.ReplyJson(w, http.StatusOK, history)
+	}
+}
+
+func RollbackSecrets(w we.ResponseWriter, r we.RequestScope) error {
+	apps, profiles, labels := getParameters(r)
+	if len(apps) > 1 || len(profiles) > 1 || len(labels) > 1 {
+		return events.New(http.StatusBadRequest, "a rollback targets a single app, profile and label")
+	}
+	app, profile, label := "application", "default", "master"
+	if len(apps) == 1 {
+		app = apps[0]
+	}
+	if len(profiles) == 1 {
+		profile = profiles[0]
+	}
+	if len(labels) == 1 {
+		label = labels[0]
+	}
+
+	if s, e := targetSource(r); e != nil {
 		return e
-	} else if e = defaultSource.deleteSecrets(apps, profiles, labels, *secretNames); e != nil {
+	} else if request, e := util.ReadJsonBody[domain.RollbackRequest](r); e != nil {
+		return e
+	} else if len(request.Version) == 0 {
+		return events.New(http.StatusBadRequest, "the version to roll back to is required")
+	} else if e = s.rollback(app, profile, label, request.Version); e != nil {
+		if UnknownVersionError.IsKindOf(e) {
+			return events.New(http.StatusBadRequest, e.Error())
+		}
 		return e
 	} else {
 		w.WriteHeader(http.StatusAccepted)
 	}
 	return nil
 }
+
+func ExportSecrets(w we.ResponseWriter, r we.RequestScope) error {
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if request, e := util.ReadJsonBody[domain.ExportRequest](r); e != nil {
+		return e
+	} else if archive, e := s.exportSecrets(request.PublicKey); e != nil {
+		if e == InvalidKeyError {
+			return events.New(http.StatusBadRequest, e.Error())
+		}
+		return e
+	} else {
+		return util.ReplyJson(w, http.StatusOK, archive)
+	}
+}
+
+func ImportSecrets(w we.ResponseWriter, r we.RequestScope) error {
+	policy := r.Parameter("policy")
+	if len(policy) == 0 {
+		policy = SkipPolicy
+	}
+	dryRun := r.Parameter("dryRun") == "true"
+
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if archive, e := util.ReadJsonBody[domain.SecretsArchive](r); e != nil {
+		return e
+	} else if report, e := s.importArchive(archive, policy, dryRun); e != nil {
+		if UnknownImportPolicyError.IsKindOf(e) || InvalidImportedScopeError.IsKindOf(e) || UnsupportedArchiveError.IsKindOf(e) || e == InvalidArchiveError {
+			return events.New(http.StatusBadRequest, e.Error())
+		} else if e == NoArchiveKeyError {
+			return events.New(http.StatusNotImplemented, e.Error())
+		}
+		return e
+	} else {
+		if !dryRun {
+			audit.Keys(r, importedKeys(report))
+		}
+		return util.ReplyJson(w, http.StatusOK, report)
+	}
+}
+
+func CopySecrets(w we.ResponseWriter, r we.RequestScope) error {
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if request, e := util.ReadJsonBody[domain.CopyRequest](r); e != nil {
+		return e
+	} else if defaultScope(request.From) == defaultScope(request.To) {
+		return events.New(http.StatusBadRequest, "secrets can't be copied onto themselves")
+	} else if report, e := s.copySecrets(request.From, request.To, request.Keys, request.Force); e != nil {
+		if SourceSecretsNotFoundError.IsKindOf(e) {
+			return events.New(http.StatusNotFound, e.Error())
+		}
+		return e
+	} else {
+		audit.Keys(r, copiedKeys(request.From, request.To, report))
+		return util.ReplyJson(w, http.StatusOK, report)
+	}
+}
+
+func RotateSecrets(w we.ResponseWriter, r we.RequestScope) error {
+	apps, profiles, labels := getParameters(r)
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if secrets, e := util.ReadJsonBody[map[string]any](r); e != nil {
+		return e
+	} else {
+		audit.Keys(r, secretKeys(*secrets))
+		if rotated, e := s.rotateSecrets(apps, profiles, labels, *secrets); e != nil {
+			if InvalidGenerationSpecError.IsKindOf(e) || InvalidGenerationParametersError.IsKindOf(e) {
+				return events.New(http.StatusBadRequest, e.Error())
+			} else if UnknownRotatedSecretError.IsKindOf(e) {
+				return events.New(http.StatusNotFound, e.Error())
+			}
+			return e
+		} else {
+			return util.ReplyJson(w, http.StatusOK, rotated)
+		}
+	}
+}
+
+func ExpiringSecrets(w we.ResponseWriter, r we.RequestScope) error {
+	within := DefaultExpiringWithin
+	if parameter := r.Parameter("within"); len(parameter) > 0 {
+		var e error
+		if within, e = parseWithin(parameter); e != nil {
+			return events.New(http.StatusBadRequest, "within must be a duration like 30d or 12h")
+		}
+	}
+
+	if s, e := targetSource(r); e != nil {
+		return e
+	} else if expiring, e := s.expiringSecrets(within); e != nil {
+		return e
+	} else {
+		return util.ReplyJson(w, http.StatusOK, expiring)
+	}
+}
+
+// secretKeys returns the sorted dotted keys of secrets, generation specs and metadata excluded, for the audit log
+func secretKeys(secrets map[string]any) []string {
+	var keys []string
+	var collect func(prefix string, secrets map[string]any)
+	collect = func(prefix string, secrets map[string]any) {
+		for key, value := range secrets {
+			if len(prefix) == 0 && key == MetadataProperty {
+				continue
+			}
+			if nested, isMap := value.(map[string]any); isMap {
+				if _, _, isSpec := generationSpec(value); !isSpec {
+					collect(prefix+key+".", nested)
+					continue
+				}
+			}
+			keys = append(keys, prefix+key)
+		}
+	}
+	collect("", secrets)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// importedKeys returns the keys changed by an import, qualified by their app, profile and label
+func importedKeys(report *domain.ImportReport) []string {
+	var keys []string
+	for _, change := range report.Changes {
+		for _, changed := range [][]string{change.Added, change.Changed, change.Removed} {
+			for _, key := range changed {
+				keys = append(keys, fmt.Sprintf("%s/%s/%s/%s", change.App, change.Profile, change.Label, key))
+			}
+		}
+	}
+	return keys
+}
+
+// copiedKeys returns the keys actually written by a copy, qualified by the app, profile and label they were read from and
+// written to
+func copiedKeys(from, to domain.SecretScope, report []domain.CopiedSecret) []string {
+	from, to = defaultScope(from), defaultScope(to)
+	var keys []string
+	for _, copied := range report {
+		if copied.Result == CopiedResult || copied.Result == OverwrittenResult {
+			keys = append(keys,
+				fmt.Sprintf("%s/%s/%s/%s", from.App, from.Profile, from.Label, copied.Key),
+				fmt.Sprintf("%s/%s/%s/%s", to.App, to.Profile, to.Label, copied.Key))
+		}
+	}
+	return keys
+}
+
+// parseWithin parses a go duration, also accepting a number of days like 30d
+func parseWithin(within string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(within, "d"); found {
+		if value, e := strconv.Atoi(days); e != nil || value < 0 {
+			return 0, fmt.Errorf("invalid number of days %s", days)
+		} else {
+			return time.Duration(value) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(within)
+}
@@ -1,8 +1,12 @@
 package credhub_source
 
 import (
+	"crypto/rsa"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gomatbase/csn"
 	"github.com/gomatbase/go-log"
@@ -10,17 +14,25 @@ import (
 	"github.com/rabobank/config-hub/domain"
 	"github.com/rabobank/config-hub/sources/spi"
 	"github.com/rabobank/config-hub/util"
-	"github.com/rabobank/credhub-client"
 )
 
 const (
 	InvalidConfigurationObjectError = csn.Error("expected a credhub configuration object")
-	OnlyOneCredhubSourceError       = csn.Error("only one credhub source is allowed")
+	DuplicateCredhubSourceError     = csn.ErrorF("a credhub source named %s is already configured")
+	ReservedCredhubSourceNameError  = csn.ErrorF("the credhub source name %s is reserved by the secrets management endpoints")
 )
 
+// names of the secrets management endpoints, which would be confused with the sources addressed under /secrets/sources
+var reservedSourceNames = []string{"add", "delete", "list", "history", "rollback", "export", "import", "copy", "rotate",
+	"expiring", "sources"}
+
 var l, _ = log.GetWithOptions("CREDHUB_SOURCE", log.Standard().WithFailingCriticals().WithLogPrefix(log.Name, log.LogLevel, log.Separator).WithStartingLevel(cfg.LogLevel))
 
-var defaultSource *source
+// credhub sources by order of precedence, the first one being the default target of the secrets management endpoints
+var (
+	credhubSources []*source
+	sourcesByName  = make(map[string]*source)
+)
 
 type credentialsIndex map[string]map[string]map[string]string
 type secret struct {
@@ -108,24 +120,31 @@ func (ci *credentialsIndex) filterCredentials(apps, profiles, labels []string) [
 }
 
 type source struct {
-	prefix string
-	client credhub.Client
+	name            string
+	prefix          string
+	notificationUrl *string
+	client          util.Credhub
+	cache           *cache
+
+	// decrypts the imported archives, nil when imports are disabled
+	archiveKey *rsa.PrivateKey
 }
 
 func (s *source) ClearCache() {
-	// do nothing, credhub secrets are not cached at the source
+	l.Debugf("Clearing cache for credhub source %s", s.name)
+	s.cache.clear()
 }
 
 func (s *source) String() string {
-	return fmt.Sprintf("CredhubSource{prefix:%s}", s.prefix)
+	return fmt.Sprintf("CredhubSource{name:%s, prefix:%s, ttl:%v}", s.name, s.prefix, s.cache.ttl)
 }
 
 func (s *source) Name() string {
-	return "credhub"
+	return s.name
 }
 
-func (s *source) DashboardReport() *string {
-	return nil
+func (s *source) HoldsSecrets() bool {
+	return true
 }
 
 func (s *source) appendProfilesSecrets(app string, profiles []string, label string, result []*domain.PropertySource) []*domain.PropertySource {
@@ -138,20 +157,20 @@ func (s *source) appendProfilesSecrets(app string, profiles []string, label stri
 		l.Debugf("Getting secrets from %s\n", name)
 		var secrets map[string]any
 		var e error
-		if secrets, e = s.client.GetJsonByName(name); e != nil {
+		if secrets, e = s.getCredential(name); e != nil {
 			secrets = make(map[string]any)
 		}
 		result = append(result, &domain.PropertySource{
-			Source:     fmt.Sprintf("credhub-%s-%s-%s", app, profile, label),
+			Source:     fmt.Sprintf("%s-%s-%s-%s", s.name, app, profile, label),
 			Properties: secrets,
 		})
 	}
 	if !defaultRequested {
 		name := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, app, "default", label)
 		l.Debugf("Getting secrets from %s\n", name)
-		if secrets, e := s.client.GetJsonByName(name); e == nil {
+		if secrets, e := s.getCredential(name); e == nil {
 			result = append(result, &domain.PropertySource{
-				Source:     fmt.Sprintf("credhub-%s-default-%s", app, label),
+				Source:     fmt.Sprintf("%s-%s-default-%s", s.name, app, label),
 				Properties: secrets,
 			})
 		}
@@ -176,22 +195,23 @@ func (s *source) findProperties(apps []string, profiles []string, labels []strin
 	if len(relevantCredentials) == 0 {
 		l.Debugf("No credhub credentials found for apps: %s, profiles: %v, labels: %s", apps, profiles, labels)
 		result = append(result, &domain.PropertySource{
-			Source:     fmt.Sprintf("credhub-%s-%s-%s", apps[0], profiles[0], labels[0]),
+			Source:     fmt.Sprintf("%s-%s-%s-%s", s.name, apps[0], profiles[0], labels[0]),
 			Properties: make(map[string]interface{}),
 		})
 	}
 
+	credentials := fetchAll(credentialNames(relevantCredentials), s.getCredential)
 	for _, credReference := range relevantCredentials {
-		if credential, e := s.client.GetJsonByName(credReference.name); e != nil {
-			l.Errorf("Failed to retrieve credential %s : %v", credReference.name, e)
+		if credential := credentials[credReference.name]; credential.e != nil {
+			l.Errorf("Failed to retrieve credential %s : %v", credReference.name, credential.e)
 			result = append(result, &domain.PropertySource{
-				Source:     fmt.Sprintf("credhub-%s-%s-%s", credReference.app, credReference.profile, credReference.label),
+				Source:     fmt.Sprintf("%s-%s-%s-%s", s.name, credReference.app, credReference.profile, credReference.label),
 				Properties: make(map[string]interface{}),
 			})
 		} else {
 			result = append(result, &domain.PropertySource{
-				Source:     fmt.Sprintf("credhub-%s-%s-%s", credReference.app, credReference.profile, credReference.label),
-				Properties: credential,
+				Source:     fmt.Sprintf("%s-%s-%s-%s", s.name, credReference.app, credReference.profile, credReference.label),
+				Properties: credential.value,
 			})
 		}
 	}
@@ -199,7 +219,54 @@ func (s *source) findProperties(apps []string, profiles []string, labels []strin
 	return result, nil
 }
 
+// getCredential reads a copy of a credential in canonical form through the source cache. Writes should still read the
+// credential from credhub directly, the cached one possibly being outdated.
+func (s *source) getCredential(name string) (map[string]any, error) {
+	return s.cache.getValue(name, func(name string) (map[string]any, error) {
+		if credential, e := s.client.GetJsonByName(name); e != nil {
+			return nil, e
+		} else {
+			return flattenSecrets("", credential), nil
+		}
+	})
+}
+
+// getSecretNames reads the canonical key names of a credential through the source cache, without keeping its values
+func (s *source) getSecretNames(name string) ([]string, error) {
+	return s.cache.getNames(name, func(name string) ([]string, error) {
+		if credential, e := s.client.GetJsonByName(name); e != nil {
+			return nil, e
+		} else {
+			names := make([]string, 0, len(credential))
+			for key := range flattenSecrets("", credential) {
+				names = append(names, key)
+			}
+			sort.Strings(names)
+			return names, nil
+		}
+	})
+}
+
+func credentialNames(credentials []secret) []string {
+	names := make([]string, len(credentials))
+	for i, credential := range credentials {
+		names[i] = credential.name
+	}
+	return names
+}
+
 func (s *source) getExistingCredentials() (*credentialsIndex, error) {
+	return s.cache.getIndex(s.loadExistingCredentials)
+}
+
+// setCredential writes a credential to credhub, invalidating its cached value and the credential index
+func (s *source) setCredential(name string, value map[string]any) error {
+	defer s.cache.invalidate(name)
+	_, e := s.client.SetJsonByName(name, value)
+	return e
+}
+
+func (s *source) loadExistingCredentials() (*credentialsIndex, error) {
 	l.Debugf("Find all credentials for %s", s.prefix)
 	if credentials, e := s.client.FindByPath(s.prefix); e != nil {
 		l.Errorf("Failed to retrieve credentials for %s : %v", s.prefix, e)
@@ -207,6 +274,11 @@ func (s *source) getExistingCredentials() (*credentialsIndex, error) {
 	} else {
 		result := newCredentialsIndex()
 		for _, credential := range credentials.Credentials {
+			// only {prefix}{app}/{profile}/{label}/secrets credentials hold secrets
+			if !strings.HasSuffix(credential.Name, "/secrets") || strings.Count(credential.Name[len(s.prefix):], "/") != 3 {
+				l.Debugf("Ignoring credential : %s", credential.Name)
+				continue
+			}
 			l.Debugf("Found Credentials : %s", credential.Name)
 			result.add(credential.Name)
 		}
@@ -214,33 +286,24 @@ func (s *source) getExistingCredentials() (*credentialsIndex, error) {
 	}
 }
 
-func (s *source) listSecrets(apps []string, profiles []string, labels []string) (map[string]map[string]map[string][]string, error) {
-	var credentials *credentialsIndex
-	var e error
-
-	if credentials, e = s.getExistingCredentials(); e != nil {
+// listSecrets lists the names of the secrets matching the filter, ordered by app, profile, label and name
+func (s *source) listSecrets(filter secretsFilter) ([]domain.SecretName, error) {
+	credentials, e := s.getExistingCredentials()
+	if e != nil {
 		return nil, e
 	}
 
-	relevantCredentials := credentials.filterCredentials(apps, profiles, labels)
-	result := make(map[string]map[string]map[string][]string)
+	relevantCredentials := credentials.matchCredentials(filter)
+	secretNames := fetchAll(credentialNames(relevantCredentials), s.getSecretNames)
+	result := make([]domain.SecretName, 0)
 	for _, credReference := range relevantCredentials {
-		if credential, e := s.client.GetJsonByName(credReference.name); e != nil {
-			// log it
+		if names := secretNames[credReference.name]; names.e != nil {
+			l.Errorf("Failed to retrieve credential %s : %v", credReference.name, names.e)
 		} else {
-			app, profile, label := extractScope(credReference.name)
-			appSecrets := result[app]
-			if appSecrets == nil {
-				appSecrets = make(map[string]map[string][]string)
-				result[app] = appSecrets
-			}
-			profileSecrets := appSecrets[profile]
-			if profileSecrets == nil {
-				profileSecrets = make(map[string][]string)
-				appSecrets[profile] = profileSecrets
-			}
-			for key := range credential {
-				profileSecrets[label] = append(profileSecrets[label], key)
+			for _, name := range names.value {
+				if matchesAny(filter.keys, name) {
+					result = append(result, domain.SecretName{App: credReference.app, Profile: credReference.profile, Label: credReference.label, Name: name})
+				}
 			}
 		}
 	}
@@ -249,15 +312,48 @@ func (s *source) listSecrets(apps []string, profiles []string, labels []string)
 }
 
 func (s *source) addSecrets(apps []string, profiles []string, labels []string, secrets map[string]any) error {
-	if len(apps) == 0 {
-		apps = []string{"application"}
+	return s.writeSecrets(apps, profiles, labels, secrets, true)
+}
+
+// writeSecrets extracts the metadata and generates the requested values of the secrets before storing them, merged
+// with the existing secrets or replacing them, in which case the metadata of the keys no longer present is dropped
+func (s *source) writeSecrets(apps []string, profiles []string, labels []string, secrets map[string]any, merge bool) error {
+	secrets, metadata, e := extractMetadata(secrets)
+	if e != nil {
+		return e
 	}
-	if len(profiles) == 0 {
-		profiles = []string{"default"}
+	if secrets, _, e = s.generateSecrets(secrets); e != nil {
+		return e
 	}
-	if len(labels) == 0 {
-		labels = []string{"master"}
+	if e = s.storeSecrets(apps, profiles, labels, secrets, merge); e != nil || (merge && len(metadata) == 0) {
+		return e
+	}
+
+	keys := flattenSecrets("", secrets)
+	apps, profiles, labels = defaultTargets(apps, profiles, labels)
+	for _, app := range apps {
+		for _, profile := range profiles {
+			for _, label := range labels {
+				secretsName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, app, profile, label)
+				var removed []string
+				if !merge {
+					if removed, e = s.staleMetadata(secretsName, keys); e != nil {
+						return e
+					}
+				}
+				if e = s.updateMetadata(secretsName, metadata, removed); e != nil {
+					return e
+				}
+			}
+		}
 	}
+	return nil
+}
+
+// storeSecrets writes the secrets for all the combinations of apps, profiles and labels, merging them with the existing
+// secrets or replacing them altogether
+func (s *source) storeSecrets(apps []string, profiles []string, labels []string, secrets map[string]any, merge bool) error {
+	apps, profiles, labels = defaultTargets(apps, profiles, labels)
 	secrets = flattenSecrets("", secrets)
 	existingCredentials, e := s.getExistingCredentials()
 	if e != nil {
@@ -267,16 +363,18 @@ func (s *source) addSecrets(apps []string, profiles []string, labels []string, s
 		for _, profile := range profiles {
 			for _, label := range labels {
 				credentialName := fmt.Sprintf("%s%s/%s/%s/secrets", s.prefix, app, profile, label)
-				if existingCredentials.contains(app, profile, label) {
+				credential := secrets
+				if merge && existingCredentials.contains(app, profile, label) {
 					if existingCredential, e := s.client.GetJsonByName(credentialName); e != nil {
 						l.Errorf("Unable to read credentials %s\n", credentialName)
 						return e
 					} else {
-						secrets = mergeSecrets(existingCredential, secrets)
+						// existing credentials may still be stored in nested form, they are migrated when written
+						credential = mergeSecrets(flattenSecrets("", existingCredential), secrets)
 					}
 				}
 
-				if _, e := s.client.SetJsonByName(credentialName, secrets); e != nil {
+				if e := s.setCredential(credentialName, credential); e != nil {
 					l.Errorf("Failed to write credentials: %v\n", e)
 					return e
 				}
@@ -287,15 +385,7 @@ func (s *source) addSecrets(apps []string, profiles []string, labels []string, s
 }
 
 func (s *source) deleteSecrets(apps []string, profiles []string, labels []string, secrets []string) error {
-	if len(apps) == 0 {
-		apps = []string{"application"}
-	}
-	if len(profiles) == 0 {
-		profiles = []string{"default"}
-	}
-	if len(labels) == 0 {
-		labels = []string{"master"}
-	}
+	apps, profiles, labels = defaultTargets(apps, profiles, labels)
 	existingCredentials, e := s.getExistingCredentials()
 	if e != nil {
 		return e
@@ -308,11 +398,14 @@ func (s *source) deleteSecrets(apps []string, profiles []string, labels []string
 					if existingCredential, e := s.client.GetJsonByName(credentialName); e != nil {
 						l.Errorf("Unable to read credentials %s\n", credentialName)
 						return e
-					} else if credentials, deleted := deleteSecrets(existingCredential, secrets); deleted {
-						if _, e := s.client.SetJsonByName(credentialName, credentials); e != nil {
+					} else if credentials, deleted := deleteSecrets(flattenSecrets("", existingCredential), secrets); deleted {
+						if e := s.setCredential(credentialName, credentials); e != nil {
 							l.Errorf("Failed to write credentials %s\n", e)
 							return e
 						}
+						if e := s.updateMetadata(credentialName, nil, secrets); e != nil {
+							return e
+						}
 					}
 				}
 			}
@@ -321,75 +414,60 @@ func (s *source) deleteSecrets(apps []string, profiles []string, labels []string
 	return nil
 }
 
+// mergeSecrets adds the secrets to the existing ones, both in canonical form
 func mergeSecrets(existingSecrets map[string]any, secrets map[string]any) map[string]any {
 	for k, v := range secrets {
-		if existingSecret, found := existingSecrets[k]; found {
-			if newSecret, isMap := v.(map[string]any); isMap {
-				if existingSecretMap, isMap := existingSecret.(map[string]any); isMap {
-					existingSecrets[k] = mergeSecrets(existingSecretMap, newSecret)
-				} else {
-					existingSecrets[k] = v
-				}
-			} else {
-				existingSecrets[k] = v
-			}
-		} else {
-			existingSecrets[k] = v
-		}
+		existingSecrets[k] = v
 	}
 	return existingSecrets
 }
 
+// deleteSecrets removes the given properties from secrets in canonical form. Deleting a property also deletes all the
+// properties nested in it, so deleting "spring.datasource" deletes "spring.datasource.password".
 func deleteSecrets(existingSecrets map[string]any, properties []string) (map[string]any, bool) {
 	deleted := false
-	for _, v := range properties {
-		if _, found := existingSecrets[v]; found {
-			delete(existingSecrets, v)
-			deleted = true
-		} else {
-			parts := strings.Split(v, ".")
-			existingSecrets, deleted = findAndDelete(existingSecrets, parts[0], parts[1:])
+	for _, property := range properties {
+		for key := range existingSecrets {
+			if key == property || strings.HasPrefix(key, property+".") {
+				delete(existingSecrets, key)
+				deleted = true
+			}
 		}
 	}
 	return existingSecrets, deleted
 }
 
-func findAndDelete(secrets map[string]any, head string, remainder []string) (map[string]any, bool) {
-	deleted := false
-	if _, found := secrets[head]; found {
-		if len(remainder) == 0 {
-			delete(secrets, head)
-			deleted = true
-		} else if subSecrets, isType := secrets[head].(map[string]any); isType {
-			secrets[head], deleted = findAndDelete(subSecrets, remainder[0], remainder[1:])
-		}
-		// if there are no subSecrets then do nothing
-	} else if len(remainder) > 0 {
-		// the head is not found, merge it with the first reminder, if there is one, and try to delete from there
-		return findAndDelete(secrets, head+"."+remainder[0], remainder[1:])
-	}
-
-	return secrets, deleted
-}
-
+// flattenSecrets converts secrets to their canonical form, where nested objects are replaced by their properties with
+// dotted names, making {"spring":{"datasource":{"password":"x"}}} equivalent to {"spring.datasource.password":"x"}.
+// Lists are kept as values. Keys are processed in order, so when both forms of the same property are present the
+// dotted one prevails.
 func flattenSecrets(prefix string, secrets map[string]any) map[string]any {
-	return secrets
+	result := make(map[string]any)
+	collectValues(prefix, secrets, result)
+	return result
 }
 
-func extractScope(name string) (string, string, string) {
-	components := strings.Split(name, "/")
-	size := len(components)
-	return components[size-4], components[size-3], components[size-2]
+// DefaultClient returns the credhub client of the default credhub source, nil when no credhub source is configured
+func DefaultClient() util.Credhub {
+	if len(credhubSources) == 0 {
+		return nil
+	}
+	return credhubSources[0].client
 }
 
 func Source(sourceConfig domain.SourceConfig) (result spi.Source, e error) {
-	if defaultSource != nil {
-		return nil, OnlyOneCredhubSourceError
-	} else if credhubConfig, isType := sourceConfig.(*domain.CredhubConfig); !isType {
+	if credhubConfig, isType := sourceConfig.(*domain.CredhubConfig); !isType {
 		return nil, InvalidConfigurationObjectError
+	} else if slices.Contains(reservedSourceNames, credhubConfig.Name) {
+		return nil, ReservedCredhubSourceNameError.WithValues(credhubConfig.Name)
+	} else if sourcesByName[credhubConfig.Name] != nil {
+		return nil, DuplicateCredhubSourceError.WithValues(credhubConfig.Name)
 	} else {
 		s := &source{
-			prefix: credhubConfig.Prefix,
+			name:            credhubConfig.Name,
+			prefix:          credhubConfig.Prefix,
+			notificationUrl: credhubConfig.NotificationUrl,
+			cache:           newCache(time.Duration(credhubConfig.CacheTtl) * time.Second),
 		}
 		if !strings.HasPrefix(s.prefix, "/") {
 			s.prefix = "/" + s.prefix
@@ -401,12 +479,32 @@ func Source(sourceConfig domain.SourceConfig) (result spi.Source, e error) {
 		if s.client, e = util.CredhubClient(credhubConfig.Client, credhubConfig.Secret); e != nil {
 			return
 		}
+		if len(cfg.ArchivePrivateKey) != 0 {
+			if s.archiveKey, e = parsePrivateKey(cfg.ArchivePrivateKey); e != nil {
+				return nil, e
+			}
+		}
 
-		defaultSource = s
+		credhubSources = append(credhubSources, s)
+		sourcesByName[s.name] = s
 		return s, nil
 	}
 }
 
+// defaultTargets defaults the apps, profiles and labels written to when none are given
+func defaultTargets(apps []string, profiles []string, labels []string) ([]string, []string, []string) {
+	if len(apps) == 0 {
+		apps = []string{"application"}
+	}
+	if len(profiles) == 0 {
+		profiles = []string{"default"}
+	}
+	if len(labels) == 0 {
+		labels = []string{"master"}
+	}
+	return apps, profiles, labels
+}
+
 func ensureApplication(apps []string) []string {
 	if len(apps) == 0 || len(apps) == 1 && apps[0] == "application" {
 		return []string{"application"}
@@ -0,0 +1,109 @@
+package credhub_source
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gomatbase/go-we"
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestFlattenSecrets(t *testing.T) {
+	nested := map[string]any{"spring": map[string]any{"datasource": map[string]any{"password": "x"}}, "list": []any{"a", "b"}}
+	dotted := map[string]any{"spring.datasource.password": "x", "list": []any{"a", "b"}}
+
+	if flattened := flattenSecrets("", nested); !reflect.DeepEqual(flattened, dotted) {
+		t.Errorf("expected %v, got %v", dotted, flattened)
+	}
+	if flattened := flattenSecrets("", dotted); !reflect.DeepEqual(flattened, dotted) {
+		t.Errorf("expected canonical secrets to be unchanged, got %v", flattened)
+	}
+
+	mixed := map[string]any{"a": map[string]any{"b": "nested"}, "a.b": "dotted"}
+	if flattened := flattenSecrets("", mixed); flattened["a.b"] != "dotted" || len(flattened) != 1 {
+		t.Errorf("expected dotted key to prevail, got %v", flattened)
+	}
+}
+
+func TestMergeAndDeleteCanonicalSecrets(t *testing.T) {
+	existing := flattenSecrets("", map[string]any{"spring": map[string]any{"datasource": map[string]any{"password": "x", "username": "u"}}})
+	merged := mergeSecrets(existing, flattenSecrets("", map[string]any{"spring.datasource.password": "y"}))
+	expected := map[string]any{"spring.datasource.password": "y", "spring.datasource.username": "u"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+
+	if remaining, deleted := deleteSecrets(merged, []string{"spring.datasource.password"}); !deleted || len(remaining) != 1 {
+		t.Errorf("expected a single property to be deleted, got %v", remaining)
+	}
+	if remaining, deleted := deleteSecrets(merged, []string{"spring.datasource"}); !deleted || len(remaining) != 0 {
+		t.Errorf("expected nested properties to be deleted, got %v", remaining)
+	}
+	if _, deleted := deleteSecrets(map[string]any{"spring.datasourcex": "z"}, []string{"spring.datasource"}); deleted {
+		t.Errorf("expected only nested properties to be deleted")
+	}
+}
+
+func TestSecretKeys(t *testing.T) {
+	keys := secretKeys(map[string]any{
+		"spring":         map[string]any{"datasource": map[string]any{"password": "x"}},
+		"api.key":        "y",
+		"db.password":    map[string]any{"generate": "password", "length": 32},
+		MetadataProperty: map[string]any{"api.key": map[string]any{"owner": "team"}},
+	})
+	expected := []string{"api.key", "db.password", "spring.datasource.password"}
+	if !slices.Equal(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestNamedSources(t *testing.T) {
+	defer func(sources []*source, byName map[string]*source) {
+		credhubSources, sourcesByName = sources, byName
+	}(credhubSources, sourcesByName)
+	credhubSources, sourcesByName = nil, make(map[string]*source)
+
+	for _, name := range []string{"credhub", "vault"} {
+		if _, e := Source(&domain.CredhubConfig{Name: name, Prefix: name}); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if _, e := Source(&domain.CredhubConfig{Name: "vault", Prefix: "other"}); !DuplicateCredhubSourceError.IsKindOf(e) {
+		t.Errorf("expected duplicate source names to be rejected, got %v", e)
+	}
+	for _, name := range []string{"history", "sources"} {
+		if _, e := Source(&domain.CredhubConfig{Name: name, Prefix: name}); !ReservedCredhubSourceNameError.IsKindOf(e) {
+			t.Errorf("expected the source name %s matching an endpoint to be rejected, got %v", name, e)
+		}
+	}
+
+	engine := we.New()
+	target := func(w we.ResponseWriter, r we.RequestScope) error {
+		s, e := targetSource(r)
+		if e != nil {
+			return e
+		}
+		_, e = w.Write([]byte(s.name))
+		return e
+	}
+	engine.HandleMethod("GET", "/secrets/history", target)
+	engine.HandleMethod("GET", "/secrets/sources/{source}/history", target)
+
+	for path, expected := range map[string]string{
+		"/secrets/history":                 "credhub",
+		"/secrets/sources/vault/history":   "vault",
+		"/secrets/sources/credhub/history": "credhub",
+		"/secrets/sources/missing/history": "",
+	} {
+		recorder := httptest.NewRecorder()
+		engine.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if len(expected) == 0 && recorder.Code != http.StatusNotFound {
+			t.Errorf("expected unknown sources not to be found on %s, got %d", path, recorder.Code)
+		} else if len(expected) != 0 && recorder.Body.String() != expected {
+			t.Errorf("expected %s to target %s, got %d %s", path, expected, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"text/template"
 
 	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/security"
+	"github.com/rabobank/config-hub/domain"
 )
 
 type SourceDashboardReport struct {
@@ -12,6 +14,12 @@ type SourceDashboardReport struct {
 	RawHtml *string
 }
 
+type dashboardReport struct {
+	User    string
+	Role    string
+	Sources []SourceDashboardReport
+}
+
 var dashboardTemplate = template.Must(template.New("dashboard").Parse("<!DOCTYPE html>\n" +
 	"<html lang=\"en\">\n" +
 	"    <head>\n" +
@@ -37,7 +45,11 @@ var dashboardTemplate = template.Must(template.New("dashboard").Parse("<!DOCTYPE
 	"    <body>\n" +
 	"        <div class=\"report\">\n" +
 	"            <h1 class=\"title\">Config Hub Dashboard</h1>\n" +
-	"{{range .}}" +
+	"{{if .User}}" +
+	"            <div class=\"user\"><span class=\"label\">Signed in as</span>&nbsp;<span class=\"value\">{{.User}}</span>" +
+	"&nbsp;<span class=\"label\">with role</span>&nbsp;<span class=\"value role\">{{.Role}}</span></div>\n" +
+	"{{end}}" +
+	"{{range .Sources}}" +
 	"            <div class=\"source\">\n" +
 	"                <h2 class=\"source-title\"><span class=\"label\">Source</span>&nbsp;<span class=\"value\">{{.Name}}</span></h2>\n" +
 	"{{if .RawHtml}}" +
@@ -51,13 +63,18 @@ var dashboardTemplate = template.Must(template.New("dashboard").Parse("<!DOCTYPE
 	"    </body>\n" +
 	"</html>"))
 
-func Dashboard(writer we.ResponseWriter, _ we.RequestScope) error {
+func Dashboard(writer we.ResponseWriter, scope we.RequestScope) error {
 	writer.WriteHeader(http.StatusOK)
 
-	sourceDashboards := make([]SourceDashboardReport, len(propertySources))
+	report := dashboardReport{Sources: make([]SourceDashboardReport, len(propertySources))}
+	if user, isUser := scope.Get(security.UserAttributeName).(*security.User); isUser {
+		report.User = template.HTMLEscapeString(user.Username)
+		role, _ := scope.Get(domain.RoleAttributeName).(domain.Role)
+		report.Role = role.String()
+	}
 	for i, s := range propertySources {
-		sourceDashboards[i] = SourceDashboardReport{Name: s.Name(), RawHtml: s.DashboardReport()}
+		report.Sources[i] = SourceDashboardReport{Name: s.Name(), RawHtml: s.DashboardReport()}
 	}
 
-	return dashboardTemplate.Execute(writer, sourceDashboards)
+	return dashboardTemplate.Execute(writer, report)
 }
@@ -0,0 +1,146 @@
+package env_source
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-log"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/spi"
+	"github.com/rabobank/config-hub/util"
+)
+
+const (
+	InvalidConfigurationObjectError = csn.Error("expected an env configuration object")
+)
+
+var l, _ = log.GetWithOptions("ENV_SOURCE", log.Standard().WithFailingCriticals().WithLogPrefix(log.Name, log.LogLevel, log.Separator).WithStartingLevel(cfg.LogLevel))
+
+type cfService struct {
+	Name        string         `json:"name"`
+	Label       string         `json:"label"`
+	Credentials map[string]any `json:"credentials"`
+}
+
+type source struct {
+	apps       map[string]bool
+	profiles   map[string]bool
+	properties map[string]any
+}
+
+func (s *source) String() string {
+	return fmt.Sprintf("EnvSource{apps:%v, profiles:%v, properties:%d}", keys(s.apps), keys(s.profiles), len(s.properties))
+}
+
+func (s *source) Name() string {
+	return "env"
+}
+
+func (s *source) DashboardReport() *string {
+	return nil
+}
+
+func (s *source) ClearCache() {
+	// do nothing, the environment is read once at startup
+}
+
+func (s *source) FindProperties(apps []string, profiles []string, _ string) ([]*domain.PropertySource, error) {
+	if !s.includes(s.apps, apps) || !s.includes(s.profiles, profiles) {
+		return nil, nil
+	}
+	return []*domain.PropertySource{{Source: "env", Properties: maps.Clone(s.properties)}}, nil
+}
+
+// includes checks if any of the requested values is allowed. An empty allow-list allows everything
+func (s *source) includes(allowed map[string]bool, requested []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, value := range requested {
+		if allowed[value] {
+			return true
+		}
+	}
+	return false
+}
+
+func readServices() (map[string]*cfService, error) {
+	services := make(map[string]*cfService)
+	vcap, found := os.LookupEnv("VCAP_SERVICES")
+	if !found {
+		return services, nil
+	}
+
+	var servicesByLabel map[string][]*cfService
+	if e := json.Unmarshal([]byte(vcap), &servicesByLabel); e != nil {
+		return nil, e
+	}
+	for _, labelServices := range servicesByLabel {
+		for _, service := range labelServices {
+			services[service.Name] = service
+		}
+	}
+	return services, nil
+}
+
+func Source(sourceConfig domain.SourceConfig) (spi.Source, error) {
+	envConfig, isType := sourceConfig.(*domain.EnvConfig)
+	if !isType {
+		return nil, InvalidConfigurationObjectError
+	}
+
+	s := &source{
+		apps:       toSet(envConfig.Apps),
+		profiles:   toSet(envConfig.Profiles),
+		properties: make(map[string]any),
+	}
+
+	for variable, property := range envConfig.Variables {
+		if value, found := os.LookupEnv(variable); found {
+			s.properties[property] = value
+		} else {
+			l.Warningf("Environment variable %s is not set", variable)
+		}
+	}
+
+	services, e := readServices()
+	if e != nil {
+		return nil, e
+	}
+	for name, mapping := range envConfig.Services {
+		service := services[name]
+		if service == nil {
+			l.Warningf("Service instance %s is not bound", name)
+			continue
+		}
+		for credential, property := range mapping {
+			if value, found := util.Get(credential, service.Credentials); found {
+				s.properties[property] = value
+			} else {
+				l.Warningf("Service instance %s has no credential %s", name, credential)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func toSet(values []string) map[string]bool {
+	result := make(map[string]bool)
+	for _, value := range values {
+		result[value] = true
+	}
+	return result
+}
+
+func keys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package env_source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("DB_URL", "jdbc:postgresql://db")
+	t.Setenv("VCAP_SERVICES", `{"p.redis": [{"name": "cache", "label": "p.redis", "credentials": {"host": "redis.internal", "auth": {"password": "secret"}}}]}`)
+
+	envSource, e := Source(&domain.EnvConfig{
+		SourceType: domain.EnvSourceType,
+		Apps:       []string{"payments"},
+		Profiles:   []string{"dev", "prod"},
+		Variables:  map[string]string{"DB_URL": "spring.datasource.url", "UNSET_VARIABLE": "unset"},
+		Services: map[string]map[string]string{
+			"cache":   {"host": "spring.redis.host", "auth.password": "spring.redis.password", "port": "spring.redis.port"},
+			"unbound": {"uri": "unbound.uri"},
+		},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	expected := map[string]any{
+		"spring.datasource.url": "jdbc:postgresql://db",
+		"spring.redis.host":     "redis.internal",
+		"spring.redis.password": "secret",
+	}
+	properties, e := envSource.FindProperties([]string{"orders", "payments"}, []string{"prod"}, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(properties) != 1 || !reflect.DeepEqual(properties[0].Properties, expected) {
+		t.Fatalf("expected %v, got %v", expected, properties)
+	}
+
+	// callers get their own copy of the properties
+	properties[0].Properties["spring.datasource.url"] = "changed"
+	if properties, _ = envSource.FindProperties([]string{"payments"}, []string{"dev"}, ""); properties[0].Properties["spring.datasource.url"] != "jdbc:postgresql://db" {
+		t.Errorf("expected the source properties not to be changed by callers")
+	}
+
+	for _, request := range [][2][]string{{{"orders"}, {"prod"}}, {{"payments"}, {"test"}}} {
+		if properties, _ = envSource.FindProperties(request[0], request[1], ""); properties != nil {
+			t.Errorf("expected no properties for apps %v and profiles %v, got %v", request[0], request[1], properties)
+		}
+	}
+}
+
+func TestEnvSourceWithoutFilters(t *testing.T) {
+	t.Setenv("DB_URL", "jdbc:postgresql://db")
+
+	envSource, e := Source(&domain.EnvConfig{SourceType: domain.EnvSourceType, Variables: map[string]string{"DB_URL": "db.url"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if properties, _ := envSource.FindProperties([]string{"any"}, []string{"default"}, ""); len(properties) != 1 || properties[0].Properties["db.url"] != "jdbc:postgresql://db" {
+		t.Errorf("expected the properties to be served to any app and profile, got %v", properties)
+	}
+
+	t.Setenv("VCAP_SERVICES", "not json")
+	if _, e = Source(&domain.EnvConfig{SourceType: domain.EnvSourceType}); e == nil {
+		t.Errorf("expected invalid VCAP_SERVICES to be rejected")
+	}
+}
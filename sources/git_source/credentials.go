@@ -1,20 +1,46 @@
 package git_source
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 
 	"github.com/gomatbase/csn"
 	"github.com/gomatbase/go-we"
+	"github.com/gomatbase/go-we/events"
 	"github.com/gomatbase/go-we/util"
 	"github.com/rabobank/config-hub/domain"
 )
 
 const (
 	HttpUriFormat = "%s://%s%s"
+
+	// CredentialsTokenVariable is the environment variable passing the credentials token to the git credentials helper
+	CredentialsTokenVariable = "CH_TOKEN"
 )
 
-var credentials = make(map[string]*domain.GitConfig)
+var (
+	credentials = make(map[string]*domain.GitConfig)
+
+	// credentialsToken is minted per process and only given to the git commands it runs, so only their credentials
+	// helper can read git credentials
+	credentialsToken = newCredentialsToken()
+)
+
+func newCredentialsToken() string {
+	token := make([]byte, 32)
+	if _, e := rand.Read(token); e != nil {
+		panic(e)
+	}
+	return hex.EncodeToString(token)
+}
+
+// validCredentialsToken checks the token sent by the credentials helper in constant time
+func validCredentialsToken(token *string) bool {
+	return token != nil && subtle.ConstantTimeCompare([]byte(*token), []byte(credentialsToken)) == 1
+}
 
 func addCredentials(config *domain.GitConfig) {
 	credentials[config.Uri] = config
@@ -26,6 +52,11 @@ func ServeCredentials(w we.ResponseWriter, r we.RequestScope) error {
 		return e
 	}
 
+	if !validCredentialsToken(credentialsRequest.Token) {
+		l.Warningf("Rejected git credentials request for %s without a valid token", credentialsRequest.Host)
+		return events.ForbiddenError
+	}
+
 	if gitConfig := credentials[fmt.Sprintf(HttpUriFormat, credentialsRequest.Protocol, credentialsRequest.Host, credentialsRequest.Repo)]; gitConfig != nil {
 		response := &domain.HttpCredentials{
 			Username: ite[string](gitConfig.Username, "user"),
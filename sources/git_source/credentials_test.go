@@ -0,0 +1,21 @@
+package git_source
+
+import "testing"
+
+func TestValidCredentialsToken(t *testing.T) {
+	token := credentialsToken
+	other := newCredentialsToken()
+	empty := ""
+
+	if len(token) != 64 || token == other {
+		t.Errorf("expected random 32 bytes tokens")
+	}
+	if !validCredentialsToken(&token) {
+		t.Errorf("expected the process token to be valid")
+	}
+	for _, invalid := range []*string{nil, &empty, &other} {
+		if validCredentialsToken(invalid) {
+			t.Errorf("expected token %v to be rejected", invalid)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/gomatbase/go-log"
 	"github.com/rabobank/config-hub/cfg"
 	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/azure"
 )
 
 const (
@@ -58,8 +59,7 @@ type Repository struct {
 	detached    bool
 
 	authenticationMethod int
-	spnCredentials       *spnCredentials
-	miWifCredentials     *miWifCredentials
+	azCredentials        azure.Credentials
 
 	lock sync.Mutex
 }
@@ -113,7 +113,7 @@ func Git(config *domain.GitConfig, baseDir string) (*Repository, error) {
 		l.Debugf("Repository %s configured with az mi wif for mi %s of tenant %s", config.Uri, *config.AzMiId, *config.AzTenantId)
 		repository.authenticationMethod = AzMiWifAuthentication
 		var e error
-		if repository.miWifCredentials, e = newMiWifCredentials(*config.AzTenantId, *config.AzMiId, *config.AzMiWifIssuer, *config.AzMiWifClient, *config.AzMiWifSecret, *config.Username, *config.Password); e != nil {
+		if repository.azCredentials, e = azure.FromConfig(&config.AzureConfig, config.Username, config.Password, azure.DevOpsScope); e != nil {
 			l.Error(e)
 			return nil, e
 		}
@@ -121,7 +121,7 @@ func Git(config *domain.GitConfig, baseDir string) (*Repository, error) {
 		l.Debugf("Repository %s configured with az spn authentication for client %s of tenant %s", config.Uri, *config.AzClient, *config.AzTenantId)
 		repository.authenticationMethod = AzSpnAuthentication
 		var e error
-		if repository.spnCredentials, e = newSpnCredentials(*config.AzTenantId, *config.AzClient, config.AzSecret, config.AzSecretCredhubClient, config.AzSecretCredhubSecret, config.AzSecretCredhubReference); e != nil {
+		if repository.azCredentials, e = azure.FromConfig(&config.AzureConfig, config.Username, config.Password, azure.DevOpsScope); e != nil {
 			l.Error(e)
 			return nil, e
 		}
@@ -275,14 +275,14 @@ func (r *Repository) exec(parameters []string) (*bytes.Buffer, error) {
 
 	switch r.authenticationMethod {
 	case AzSpnAuthentication:
-		if token, e := r.spnCredentials.token(); e != nil {
+		if token, e := r.azCredentials.Token(); e != nil {
 			return nil, e
 		} else {
 			env = append(os.Environ(), "SPN_TOKEN=Authorization: Bearer "+token)
 		}
 		parameters = append([]string{"--config-env=http.extraHeader=SPN_TOKEN"}, parameters...)
 	case AzMiWifAuthentication:
-		if token, e := r.miWifCredentials.token(); e != nil {
+		if token, e := r.azCredentials.Token(); e != nil {
 			return nil, e
 		} else {
 			env = append(os.Environ(), "MI_WIF_TOKEN=Authorization: Bearer "+token)
@@ -291,6 +291,7 @@ func (r *Repository) exec(parameters []string) (*bytes.Buffer, error) {
 	default:
 		env = os.Environ()
 	}
+	env = append(env, CredentialsTokenVariable+"="+credentialsToken)
 
 	cmd := exec.Command("git", parameters...)
 	cmd.Dir = r.base
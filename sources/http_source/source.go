@@ -0,0 +1,205 @@
+package http_source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-log"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/spi"
+	"github.com/rabobank/config-hub/util"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	InvalidConfigurationObjectError = csn.Error("expected an http configuration object")
+	UnexpectedResponseError         = csn.ErrorF("unexpected response from %s : %d")
+)
+
+var l, _ = log.GetWithOptions("HTTP_SOURCE", log.Standard().WithFailingCriticals().WithLogPrefix(log.Name, log.LogLevel, log.Separator).WithStartingLevel(cfg.LogLevel))
+
+type cachedResponse struct {
+	etag    string
+	sources []*domain.PropertySource
+}
+
+// copy returns deep copies of the cached property sources, so callers can't alter the cache
+func (cr *cachedResponse) copy() []*domain.PropertySource {
+	sources := make([]*domain.PropertySource, len(cr.sources))
+	for i, propertySource := range cr.sources {
+		sources[i] = &domain.PropertySource{Source: propertySource.Source, Properties: copyValue(propertySource.Properties).(map[string]any)}
+	}
+	return sources
+}
+
+// copyValue deep copies the maps and lists of a decoded json value
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, element := range v {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, element := range v {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	}
+	return value
+}
+
+type source struct {
+	uri               string
+	skipSslValidation bool
+	authorization     func() (string, error)
+	timeout           time.Duration
+
+	// last upstream response per requested url, kept only when the upstream provides an etag
+	cache map[string]*cachedResponse
+
+	lock sync.Mutex
+}
+
+func (s *source) String() string {
+	return fmt.Sprintf("HttpSource{uri:%s}", s.uri)
+}
+
+func (s *source) Name() string {
+	return s.uri
+}
+
+func (s *source) DashboardReport() *string {
+	return nil
+}
+
+func (s *source) ClearCache() {
+	l.Debugf("Clearing cache for http source %s", s.uri)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cache = make(map[string]*cachedResponse)
+}
+
+func (s *source) FindProperties(apps []string, profiles []string, label string) ([]*domain.PropertySource, error) {
+	// profiles are given by precedence, the upstream expects them in request order (last one with most precedence)
+	requestProfiles := make([]string, len(profiles))
+	for i, profile := range profiles {
+		requestProfiles[len(profiles)-1-i] = profile
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/%s", s.uri, strings.Join(apps, ","), strings.Join(requestProfiles, ","))
+	if len(label) != 0 {
+		endpoint = endpoint + "/" + strings.ReplaceAll(label, "/", "(_)")
+	}
+	l.Debugf("Requesting properties from %s", endpoint)
+
+	s.lock.Lock()
+	cached := s.cache[endpoint]
+	s.lock.Unlock()
+
+	request := util.Request(endpoint).Accepting("application/json").IgnoringSsl(s.skipSslValidation).WithTimeout(s.timeout)
+	if s.authorization != nil {
+		if authorization, e := s.authorization(); e != nil {
+			return nil, e
+		} else {
+			request.WithAuthorization(authorization)
+		}
+	}
+	if cached != nil {
+		request.WithHeader("If-None-Match", cached.etag)
+	}
+
+	response, e := request.DoWithResponse(http.MethodGet)
+	if e != nil {
+		l.Errorf("Failed to request properties from %s : %v", endpoint, e)
+		return nil, e
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		if cached != nil {
+			return cached.copy(), nil
+		}
+		return nil, UnexpectedResponseError.WithValues(endpoint, response.StatusCode)
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		body, _ := io.ReadAll(response.Body)
+		l.Errorf("Unexpected response from %s : %d %s", endpoint, response.StatusCode, string(body))
+		return nil, UnexpectedResponseError.WithValues(endpoint, response.StatusCode)
+	}
+
+	configs := &domain.Configs{}
+	if e = json.NewDecoder(response.Body).Decode(configs); e != nil {
+		return nil, e
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if etag := response.Header.Get("ETag"); len(etag) != 0 {
+		cached = &cachedResponse{etag: etag, sources: configs.Sources}
+		s.cache[endpoint] = cached
+		return cached.copy(), nil
+	}
+	delete(s.cache, endpoint)
+
+	return configs.Sources, nil
+}
+
+func authorization(config *domain.HttpConfig) func() (string, error) {
+	switch config.Authentication {
+	case domain.HttpBearerAuthentication:
+		return func() (string, error) {
+			return "Bearer " + *config.Token, nil
+		}
+	case domain.HttpBasicAuthentication:
+		request, _ := http.NewRequest(http.MethodGet, config.Uri, nil)
+		request.SetBasicAuth(*config.Username, *config.Password)
+		basic := request.Header.Get("Authorization")
+		return func() (string, error) {
+			return basic, nil
+		}
+	case domain.HttpOAuthAuthentication:
+		credentials := &clientcredentials.Config{
+			ClientID:     *config.ClientId,
+			ClientSecret: *config.ClientSecret,
+			TokenURL:     *config.TokenUri,
+			Scopes:       config.Scopes,
+		}
+		tokenSource := credentials.TokenSource(context.Background())
+		return func() (string, error) {
+			if token, e := tokenSource.Token(); e != nil {
+				return "", e
+			} else {
+				return "Bearer " + token.AccessToken, nil
+			}
+		}
+	}
+	return nil
+}
+
+func Source(sourceConfig domain.SourceConfig) (spi.Source, error) {
+	if httpConfig, isType := sourceConfig.(*domain.HttpConfig); !isType {
+		return nil, InvalidConfigurationObjectError
+	} else {
+		return &source{
+			uri:               httpConfig.Uri,
+			skipSslValidation: httpConfig.SkipSslValidation,
+			authorization:     authorization(httpConfig),
+			timeout:           time.Duration(cfg.HttpTimeout) * time.Second,
+			cache:             make(map[string]*cachedResponse),
+		}, nil
+	}
+}
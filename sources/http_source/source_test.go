@@ -0,0 +1,82 @@
+package http_source
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+func TestUpstreamETag(t *testing.T) {
+	requests := 0
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/payments/dev,prod/release(_)1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&domain.Configs{
+			App:      "payments",
+			Profiles: []string{"dev", "prod"},
+			Sources:  []*domain.PropertySource{{Source: "upstream-payments-prod", Properties: map[string]any{"key": "value", "nested": map[string]any{"key": "value"}}}},
+		})
+	}))
+	defer server.Close()
+
+	config := &domain.HttpConfig{}
+	if e := config.FromMap(map[string]any{"type": "http", "uri": server.URL, "authentication": "basic", "username": "user", "password": "password"}); e != nil {
+		t.Fatal(e)
+	}
+	s, _ := Source(config)
+
+	for i := 0; i < 2; i++ {
+		// profiles are handed to sources by precedence
+		sources, e := s.FindProperties([]string{"payments"}, []string{"prod", "dev"}, "release/1")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(sources) != 1 || sources[0].Properties["key"] != "value" || sources[0].Properties["nested"].(map[string]any)["key"] != "value" {
+			t.Errorf("Expected upstream property sources to be spliced, got %v", sources)
+		}
+		// callers altering the returned sources, as masking did, must not alter the cache
+		sources[0].Properties["key"] = "altered"
+		sources[0].Properties["nested"].(map[string]any)["key"] = "altered"
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("Expected the second request to be answered as not modified, got %d requests and %d not modified", requests, notModified)
+	}
+
+	if sources, e := s.FindProperties([]string{"unknown"}, []string{"default"}, ""); e != nil || sources != nil {
+		t.Errorf("Expected no property sources for an unknown application, got %v, %v", sources, e)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer server.Close()
+	defer close(release)
+
+	s := &source{uri: server.URL, timeout: 100 * time.Millisecond, cache: make(map[string]*cachedResponse)}
+	start := time.Now()
+	if _, e := s.FindProperties([]string{"payments"}, []string{"default"}, ""); e == nil {
+		t.Errorf("expected requests to an unresponsive upstream to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected requests to time out after %v, took %v", s.timeout, elapsed)
+	}
+}
@@ -0,0 +1,259 @@
+package keyvault_source
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomatbase/csn"
+	"github.com/gomatbase/go-log"
+	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/sources/azure"
+	"github.com/rabobank/config-hub/sources/spi"
+	"github.com/rabobank/config-hub/util"
+)
+
+const (
+	InvalidConfigurationObjectError = csn.Error("expected a key vault configuration object")
+
+	ApiVersion      = "7.4"
+	SecretsEndpoint = "%s/secrets?api-version=%s"
+	SecretEndpoint  = "%s/secrets/%s?api-version=%s"
+)
+
+var l, _ = log.GetWithOptions("KEYVAULT_SOURCE", log.Standard().WithFailingCriticals().WithLogPrefix(log.Name, log.LogLevel, log.Separator).WithStartingLevel(cfg.LogLevel))
+
+type secretItem struct {
+	Id         string `json:"id"`
+	Attributes struct {
+		Enabled bool `json:"enabled"`
+	} `json:"attributes"`
+}
+
+type secretList struct {
+	Value    []secretItem `json:"value"`
+	NextLink *string      `json:"nextLink"`
+}
+
+type secretBundle struct {
+	Value string `json:"value"`
+}
+
+type vaultSecret struct {
+	name string
+	key  string
+}
+
+// secretsIndex maps the lower-cased application and profile names to the secrets available for them. Key vault
+// secret names are case-insensitive.
+type secretsIndex map[string]map[string][]vaultSecret
+
+type source struct {
+	vaultUri       string
+	separator      string
+	dotReplacement string
+	cacheTtl       time.Duration
+	credentials    azure.Credentials
+
+	index      secretsIndex
+	values     map[string]string
+	expiration time.Time
+	generation int
+
+	lock sync.Mutex
+}
+
+func (s *source) String() string {
+	return fmt.Sprintf("KeyVaultSource{vault:%s, separator:%s, ttl:%v}", s.vaultUri, s.separator, s.cacheTtl)
+}
+
+func (s *source) Name() string {
+	return s.vaultUri
+}
+
+func (s *source) HoldsSecrets() bool {
+	return true
+}
+
+func (s *source) DashboardReport() *string {
+	return nil
+}
+
+func (s *source) ClearCache() {
+	l.Debugf("Clearing cache for key vault source %s", s.vaultUri)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.expiration = time.Time{}
+}
+
+func (s *source) FindProperties(apps []string, profiles []string, _ string) ([]*domain.PropertySource, error) {
+	l.Debugf("Finding properties from key vault %s for app(s):%v and profiles:%s", s.vaultUri, apps, profiles)
+
+	index, e := s.secretsIndex()
+	if e != nil {
+		return nil, e
+	}
+
+	if !util.HasApplication(apps) {
+		apps = append(apps, "application")
+	}
+	if !hasDefaultProfile(profiles) {
+		profiles = append(profiles, "default")
+	}
+
+	var result []*domain.PropertySource
+	for _, app := range apps {
+		for _, profile := range profiles {
+			secrets := index[strings.ToLower(app)][strings.ToLower(profile)]
+			if len(secrets) == 0 {
+				continue
+			}
+			properties := make(map[string]any)
+			for _, secret := range secrets {
+				if value, e := s.value(secret.name); e != nil {
+					l.Errorf("Failed to retrieve secret %s : %v", secret.name, e)
+				} else {
+					properties[secret.key] = value
+				}
+			}
+			result = append(result, &domain.PropertySource{
+				Source:     fmt.Sprintf("keyvault-%s-%s", app, profile),
+				Properties: properties,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// secretsIndex returns the index of the enabled secrets in the vault, reloading it and dropping all cached values when
+// expired. The vault is listed without holding the lock, so reads aren't serialized behind the key vault latency.
+func (s *source) secretsIndex() (secretsIndex, error) {
+	s.lock.Lock()
+	if time.Now().Before(s.expiration) {
+		index := s.index
+		s.lock.Unlock()
+		return index, nil
+	}
+	s.lock.Unlock()
+
+	index, e := s.listSecrets()
+	if e != nil {
+		return nil, e
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.index = index
+	s.values = make(map[string]string)
+	s.generation++
+	s.expiration = time.Now().Add(s.cacheTtl)
+	return index, nil
+}
+
+func (s *source) listSecrets() (secretsIndex, error) {
+	token, e := s.credentials.Token()
+	if e != nil {
+		return nil, e
+	}
+
+	index := make(secretsIndex)
+	for next := fmt.Sprintf(SecretsEndpoint, s.vaultUri, ApiVersion); len(next) != 0; {
+		page := &secretList{}
+		if e = util.Request(next).WithBearerToken(token).GetJson(page); e != nil {
+			l.Errorf("Failed to list secrets of %s : %v", s.vaultUri, e)
+			return nil, e
+		}
+		for _, item := range page.Value {
+			if item.Attributes.Enabled {
+				index.add(item.Id[strings.LastIndex(item.Id, "/")+1:], s.separator, s.dotReplacement)
+			}
+		}
+		next = util.EmptyIfNil(page.NextLink)
+	}
+	return index, nil
+}
+
+// value returns the cached value of the secret, reading it from the vault without holding the lock. Values read while
+// the index was reloaded are not cached, as they may predate the reload.
+func (s *source) value(name string) (string, error) {
+	s.lock.Lock()
+	value, found := s.values[name]
+	generation := s.generation
+	s.lock.Unlock()
+	if found {
+		return value, nil
+	}
+
+	token, e := s.credentials.Token()
+	if e != nil {
+		return "", e
+	}
+
+	bundle := &secretBundle{}
+	if e = util.Request(fmt.Sprintf(SecretEndpoint, s.vaultUri, name, ApiVersion)).WithBearerToken(token).GetJson(bundle); e != nil {
+		return "", e
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if generation == s.generation {
+		s.values[name] = bundle.Value
+	}
+	return bundle.Value, nil
+}
+
+func (si secretsIndex) add(name, separator, dotReplacement string) {
+	var app, profile, key string
+	switch parts := strings.Split(name, separator); len(parts) {
+	case 2:
+		app, profile, key = parts[0], "default", parts[1]
+	case 3:
+		app, profile, key = parts[0], parts[1], parts[2]
+	default:
+		l.Debugf("Ignoring secret %s not following the naming convention", name)
+		return
+	}
+	if len(dotReplacement) != 0 {
+		key = strings.ReplaceAll(key, dotReplacement, ".")
+	}
+
+	app, profile = strings.ToLower(app), strings.ToLower(profile)
+	profiles := si[app]
+	if profiles == nil {
+		profiles = make(map[string][]vaultSecret)
+		si[app] = profiles
+	}
+	profiles[profile] = append(profiles[profile], vaultSecret{name: name, key: key})
+}
+
+func hasDefaultProfile(profiles []string) bool {
+	for _, profile := range profiles {
+		if profile == "default" {
+			return true
+		}
+	}
+	return false
+}
+
+func newSource(config *domain.KeyVaultConfig, credentials azure.Credentials) *source {
+	return &source{
+		vaultUri:       config.VaultUri,
+		separator:      config.NameSeparator,
+		dotReplacement: config.DotReplacement,
+		cacheTtl:       time.Duration(config.CacheTtl) * time.Second,
+		credentials:    credentials,
+	}
+}
+
+func Source(sourceConfig domain.SourceConfig) (spi.Source, error) {
+	if keyVaultConfig, isType := sourceConfig.(*domain.KeyVaultConfig); !isType {
+		return nil, InvalidConfigurationObjectError
+	} else if credentials, e := azure.FromConfig(&keyVaultConfig.AzureConfig, keyVaultConfig.Username, keyVaultConfig.Password, azure.KeyVaultScope); e != nil {
+		return nil, e
+	} else {
+		return newSource(keyVaultConfig, credentials), nil
+	}
+}
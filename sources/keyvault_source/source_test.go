@@ -0,0 +1,133 @@
+package keyvault_source
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rabobank/config-hub/domain"
+)
+
+type staticToken string
+
+func (st staticToken) Token() (string, error) {
+	return string(st), nil
+}
+
+// keyVaultStandIn serves the secrets list (in pages of one secret) and secret values of the key vault rest api
+type keyVaultStandIn struct {
+	url      string
+	secrets  map[string]string
+	disabled map[string]bool
+	names    []string
+	reads    int
+}
+
+func (kv *keyVaultStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("api-version") != ApiVersion {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/secrets" {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		result := map[string]any{"value": []map[string]any{{
+			"id":         kv.url + "/secrets/" + kv.names[page],
+			"attributes": map[string]any{"enabled": !kv.disabled[kv.names[page]]},
+		}}}
+		if page+1 < len(kv.names) {
+			result["nextLink"] = kv.url + "/secrets?api-version=" + ApiVersion + "&page=" + strconv.Itoa(page+1)
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	} else if value, found := kv.secrets[strings.TrimPrefix(r.URL.Path, "/secrets/")]; found {
+		kv.reads++
+		_ = json.NewEncoder(w).Encode(map[string]any{"value": value})
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestSource(t *testing.T, kv *keyVaultStandIn) *source {
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+	kv.url = server.URL
+	for name := range kv.secrets {
+		kv.names = append(kv.names, name)
+	}
+
+	config := &domain.KeyVaultConfig{}
+	if e := config.FromMap(map[string]any{
+		"type":       "keyvault",
+		"vaultUri":   server.URL,
+		"azTenantId": "tenant",
+		"azClient":   "client",
+		"azSecret":   "secret",
+	}); e != nil {
+		t.Fatal(e)
+	}
+	return newSource(config, staticToken("test-token"))
+}
+
+func TestNamingConvention(t *testing.T) {
+	kv := &keyVaultStandIn{
+		secrets: map[string]string{
+			"payments--prod--spring-datasource-password": "prod-password",
+			"payments--spring-datasource-username":       "user",
+			"application--prod--shared-key":              "shared",
+			"payments--prod--disabled":                   "disabled",
+			"unrelated":                                  "ignored",
+		},
+		disabled: map[string]bool{"payments--prod--disabled": true},
+	}
+	s := newTestSource(t, kv)
+
+	sources, e := s.FindProperties([]string{"payments"}, []string{"prod"}, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	found := make(map[string]map[string]any)
+	for _, source := range sources {
+		found[source.Source] = source.Properties
+	}
+
+	if len(found) != 3 {
+		t.Fatalf("Expected 3 property sources, got %v", found)
+	}
+	if v := found["keyvault-payments-prod"]["spring.datasource.password"]; v != "prod-password" {
+		t.Errorf("Expected prod-password, got %v", v)
+	}
+	if _, isFound := found["keyvault-payments-prod"]["disabled"]; isFound {
+		t.Errorf("Disabled secrets should not be exposed")
+	}
+	if v := found["keyvault-payments-default"]["spring.datasource.username"]; v != "user" {
+		t.Errorf("Expected user, got %v", v)
+	}
+	if v := found["keyvault-application-prod"]["shared.key"]; v != "shared" {
+		t.Errorf("Expected shared, got %v", v)
+	}
+}
+
+func TestValuesAreCached(t *testing.T) {
+	kv := &keyVaultStandIn{secrets: map[string]string{"app--key": "value"}}
+	s := newTestSource(t, kv)
+
+	for i := 0; i < 3; i++ {
+		if _, e := s.FindProperties([]string{"app"}, []string{"default"}, ""); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if kv.reads != 1 {
+		t.Errorf("Expected a single read of the secret value, got %d", kv.reads)
+	}
+
+	s.ClearCache()
+	kv.secrets["app--key"] = "changed"
+	if sources, e := s.FindProperties([]string{"app"}, []string{"default"}, ""); e != nil {
+		t.Fatal(e)
+	} else if v := sources[0].Properties["key"]; v != "changed" {
+		t.Errorf("Expected the cleared cache to read the new value, got %v", v)
+	}
+}
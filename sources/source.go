@@ -1,6 +1,7 @@
 package sources
 
 import (
+	"maps"
 	"reflect"
 	"regexp"
 	"strings"
@@ -8,8 +9,14 @@ import (
 	"github.com/gomatbase/go-log"
 	"github.com/rabobank/config-hub/cfg"
 	"github.com/rabobank/config-hub/domain"
+	"github.com/rabobank/config-hub/masking"
+	"github.com/rabobank/config-hub/sources/appconfig_source"
+	"github.com/rabobank/config-hub/sources/consul_source"
 	"github.com/rabobank/config-hub/sources/credhub_source"
+	"github.com/rabobank/config-hub/sources/env_source"
 	"github.com/rabobank/config-hub/sources/git_source"
+	"github.com/rabobank/config-hub/sources/http_source"
+	"github.com/rabobank/config-hub/sources/keyvault_source"
 	"github.com/rabobank/config-hub/sources/spi"
 )
 
@@ -31,6 +38,26 @@ func Setup() error {
 			if propertySources[i], e = credhub_source.Source(sourceCfg); e != nil {
 				l.Critical(e)
 			}
+		case domain.ConsulSourceType:
+			if propertySources[i], e = consul_source.Source(sourceCfg); e != nil {
+				l.Critical(e)
+			}
+		case domain.KeyVaultSourceType:
+			if propertySources[i], e = keyvault_source.Source(sourceCfg); e != nil {
+				l.Critical(e)
+			}
+		case domain.AppConfigurationSourceType:
+			if propertySources[i], e = appconfig_source.Source(sourceCfg); e != nil {
+				l.Critical(e)
+			}
+		case domain.HttpSourceType:
+			if propertySources[i], e = http_source.Source(sourceCfg); e != nil {
+				l.Critical(e)
+			}
+		case domain.EnvSourceType:
+			if propertySources[i], e = env_source.Source(sourceCfg); e != nil {
+				l.Critical(e)
+			}
 		default:
 			l.Criticalf("Unsupported source type %s\n", sourceCfg.Type())
 		}
@@ -49,8 +76,10 @@ func DeleteCache() error {
 	return nil // prepare for future error handling
 }
 
-func FindProperties(app string, profiles []string, label string) []*domain.PropertySource {
-	sources := findProperties(app, profiles, label)
+// FindProperties returns the flattened properties of all sources for the app, profiles (in request order) and label.
+// When masked, all values of secrets sources and the values of sensitive keys of other sources are masked.
+func FindProperties(app string, profiles []string, label string, masked bool) []*domain.PropertySource {
+	sources, secrets := findProperties(app, profiles, label)
 	for i, properties := range sources {
 		flattenedProperties := make(map[string]interface{})
 		if e := flattenProperties("", properties.Properties, &flattenedProperties); e != nil {
@@ -58,10 +87,24 @@ func FindProperties(app string, profiles []string, label string) []*domain.Prope
 		} else {
 			sources[i].Properties = flattenedProperties
 		}
+		if masked {
+			sources[i].Properties = maskedProperties(sources[i], secrets[i])
+		}
 	}
 	return sources
 }
 
+// maskedProperties masks the properties of the property source, all of them if it comes from a secrets source
+func maskedProperties(source *domain.PropertySource, secrets bool) map[string]any {
+	properties := masking.Properties(source.Properties, secrets)
+	for _, key := range source.SecretKeys {
+		if value, found := properties[key]; found && value != nil {
+			properties[key] = masking.Mask
+		}
+	}
+	return properties
+}
+
 type dListItem struct {
 	n *dListItem
 	m *map[string]any
@@ -92,8 +135,15 @@ func insert(point *dListItem, m *map[string]any) *dListItem {
 	}
 }
 
-func FindPropertiesMap(app string, profiles []string, label string) map[string]any {
-	sources := findProperties(app, profiles, label)
+// FindPropertiesMap returns the properties of all sources for the app, profiles and label merged by precedence, masked
+// like FindProperties when requested
+func FindPropertiesMap(app string, profiles []string, label string, masked bool) map[string]any {
+	sources, secrets := findProperties(app, profiles, label)
+	if masked {
+		for i, source := range sources {
+			source.Properties = maskedProperties(source, secrets[i])
+		}
+	}
 
 	// we now need to merge all source properties from least relevant to most relevant
 	profileIndex := make(map[string]*dListItem)
@@ -145,7 +195,8 @@ func mergeMap(baseMap map[string]any, mergingMap map[string]any) map[string]any
 		if existingSecret, found := baseMap[k]; found {
 			if newSecret, isMap := v.(map[string]any); isMap {
 				if existingSecretMap, isMap := existingSecret.(map[string]any); isMap {
-					baseMap[k] = mergeMap(existingSecretMap, newSecret)
+					// the existing map may belong to a source, merge into a copy of it
+					baseMap[k] = mergeMap(maps.Clone(existingSecretMap), newSecret)
 					continue
 				}
 			}
@@ -155,8 +206,11 @@ func mergeMap(baseMap map[string]any, mergingMap map[string]any) map[string]any
 	return baseMap
 }
 
-func findProperties(app string, profiles []string, label string) []*domain.PropertySource {
+// findProperties returns the properties of all sources, and for each of them if it comes from a secrets source. The
+// property sources are copies, the returned ones possibly being cached and shared by the sources.
+func findProperties(app string, profiles []string, label string) ([]*domain.PropertySource, []bool) {
 	var sources []*domain.PropertySource
+	var secrets []bool
 	apps := strings.Split(app, ",")
 
 	// clean them up stripping the spaces
@@ -164,13 +218,25 @@ func findProperties(app string, profiles []string, label string) []*domain.Prope
 		apps[i] = strings.TrimSpace(apps[i])
 	}
 
+	// profiles are requested like in config-server, the last one with most precedence, and handed to sources by precedence
+	precedence := make([]string, len(profiles))
+	for i, profile := range profiles {
+		precedence[len(profiles)-1-i] = profile
+	}
+
 	for _, source := range propertySources {
-		if foundProperties, e := source.FindProperties(apps, profiles, label); e != nil {
+		if foundProperties, e := source.FindProperties(apps, precedence, label); e != nil {
 			l.Errorf("Error when calling source %v: %v", reflect.TypeOf(source).Name(), e)
 		} else if foundProperties != nil {
-			sources = append(sources, foundProperties...)
+			for _, properties := range foundProperties {
+				sources = append(sources, &domain.PropertySource{Source: properties.Source, Properties: properties.Properties, SecretKeys: properties.SecretKeys})
+			}
+			secretsSource, isSecretsSource := source.(spi.SecretsSource)
+			for range foundProperties {
+				secrets = append(secrets, isSecretsSource && secretsSource.HoldsSecrets())
+			}
 		}
 	}
 
-	return sources
+	return sources, secrets
 }
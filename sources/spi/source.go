@@ -8,8 +8,16 @@ import (
 
 type Source interface {
 	fmt.Stringer
+	// FindProperties returns the property sources of the apps for the profiles, given by precedence (the first one with
+	// most precedence), and label
 	FindProperties(apps []string, profiles []string, label string) ([]*domain.PropertySource, error)
 	Name() string
 	DashboardReport() *string
 	ClearCache()
 }
+
+// SecretsSource is implemented by sources holding only secrets, all their values being masked for callers without the
+// reveal privilege
+type SecretsSource interface {
+	HoldsSecrets() bool
+}
@@ -0,0 +1,183 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-community/go-uaa"
+	"github.com/rabobank/credhub-client"
+	"golang.org/x/oauth2"
+)
+
+const (
+	credhubUrl                = "https://credhub.service.cf.internal:8844"
+	getVersionsByNameEndpoint = "%s/api/v1/data?name=%s&versions=%d"
+	generateEndpoint          = "%s/api/v1/data"
+)
+
+// Credhub extends the credhub client with the versions and generate endpoints it doesn't provide. The credhub client
+// doesn't expose its authenticated transport, so these endpoints are called with a transport of its own, to be dropped
+// once the credhub client supports them.
+type Credhub interface {
+	credhub.Client
+
+	// GetJsonVersionsByName returns up to the given number of versions of a json credential, the most recent first
+	GetJsonVersionsByName(name string, versions int) ([]credhub.Credential[map[string]any], error)
+
+	// GenerateByName has credhub generate a new version of a credential of the given type with the given parameters
+	GenerateByName(name string, credentialType string, parameters map[string]any) (*credhub.Credential[any], error)
+}
+
+// GetJsonIfExists reads a json credential, nil if it doesn't exist. The credhub client doesn't tell missing credentials
+// apart from other failures, so the credential is looked up by name first.
+func GetJsonIfExists(client credhub.Client, name string) (map[string]any, error) {
+	names, e := client.FindByName(name)
+	if e != nil {
+		return nil, e
+	}
+	for _, credential := range names.Credentials {
+		if credential.Name == name {
+			return client.GetJsonByName(name)
+		}
+	}
+	return nil, nil
+}
+
+type credhubClient struct {
+	credhub.Client
+	url        string
+	httpClient credhub.HttpClient
+}
+
+func CredhubClient(client, secret *string) (Credhub, error) {
+	result := &credhubClient{url: credhubUrl}
+	var e error
+	if client != nil && secret != nil {
+		if result.Client, e = credhub.New(&credhub.Options{Client: *client, Secret: *secret}); e != nil {
+			return nil, e
+		}
+		if result.httpClient, e = newCredhubUaaClient(result.url, *client, *secret); e != nil {
+			return nil, e
+		}
+	} else {
+		if result.Client, e = credhub.New(nil); e != nil {
+			return nil, e
+		}
+		result.httpClient = &credhubMtlsClient{httpClient: &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}}
+	}
+	return result, nil
+}
+
+func (c *credhubClient) GetJsonVersionsByName(name string, versions int) ([]credhub.Credential[map[string]any], error) {
+	request, e := http.NewRequest(http.MethodGet, fmt.Sprintf(getVersionsByNameEndpoint, c.url, url.QueryEscape(name), versions), nil)
+	if e != nil {
+		return nil, e
+	}
+
+	result := &credhub.Credentials[map[string]any]{}
+	if e = c.exchange(request, name, result); e != nil {
+		return nil, e
+	}
+	return result.Data, nil
+}
+
+func (c *credhubClient) GenerateByName(name string, credentialType string, parameters map[string]any) (*credhub.Credential[any], error) {
+	body, e := json.Marshal(map[string]any{"name": name, "type": credentialType, "parameters": parameters})
+	if e != nil {
+		return nil, e
+	}
+	request, e := http.NewRequest(http.MethodPost, fmt.Sprintf(generateEndpoint, c.url), bytes.NewReader(body))
+	if e != nil {
+		return nil, e
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	result := &credhub.Credential[any]{}
+	if e = c.exchange(request, name, result); e != nil {
+		return nil, e
+	}
+	return result, nil
+}
+
+func (c *credhubClient) exchange(request *http.Request, name string, result any) error {
+	request.Header.Set("Accept", "application/json")
+	response, e := c.httpClient.Do(request)
+	if e != nil {
+		return e
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("credhub responded with status %d for %s", response.StatusCode, name)
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// credhubMtlsClient authenticates with the cf instance identity certificate, reloading it when about to expire
+type credhubMtlsClient struct {
+	lock        sync.Mutex
+	httpClient  *http.Client
+	certificate *x509.Certificate
+}
+
+func (c *credhubMtlsClient) Do(request *http.Request) (*http.Response, error) {
+	c.lock.Lock()
+	if c.certificate == nil || time.Now().Add(time.Minute).After(c.certificate.NotAfter) {
+		certificate, e := tls.LoadX509KeyPair(os.Getenv("CF_INSTANCE_CERT"), os.Getenv("CF_INSTANCE_KEY"))
+		if e == nil {
+			c.certificate, e = x509.ParseCertificate(certificate.Certificate[0])
+		}
+		if e != nil {
+			c.lock.Unlock()
+			return nil, e
+		}
+		c.httpClient.Transport.(*http.Transport).TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+	c.lock.Unlock()
+	return c.httpClient.Do(request)
+}
+
+// credhubUaaClient authenticates with a uaa client, using the authentication server advertised by credhub
+type credhubUaaClient struct {
+	lock       sync.Mutex
+	httpClient *http.Client
+	uaaClient  *uaa.API
+	token      *oauth2.Token
+}
+
+func newCredhubUaaClient(credhubUrl, client, secret string) (*credhubUaaClient, error) {
+	info := &credhub.Info{}
+	if e := Request(credhubUrl, "info").Accepting("application/json").GetJson(info); e != nil {
+		return nil, e
+	}
+
+	result := &credhubUaaClient{httpClient: &http.Client{}}
+	var e error
+	if result.uaaClient, e = uaa.New(info.AuthServer.Url, uaa.WithClientCredentials(client, secret, uaa.JSONWebToken)); e != nil {
+		return nil, e
+	}
+	return result, nil
+}
+
+func (c *credhubUaaClient) Do(request *http.Request) (*http.Response, error) {
+	c.lock.Lock()
+	if !c.token.Valid() {
+		token, e := c.uaaClient.Token(context.Background())
+		if e != nil {
+			c.lock.Unlock()
+			return nil, e
+		}
+		c.token = token
+	}
+	c.token.SetAuthHeader(request)
+	c.lock.Unlock()
+	return c.httpClient.Do(request)
+}
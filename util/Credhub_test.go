@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rabobank/credhub-client"
+)
+
+type namedCredhub struct {
+	credhub.Client
+	names []string
+}
+
+func (nc *namedCredhub) FindByName(name string) (*credhub.CredentialNames, error) {
+	result := &credhub.CredentialNames{}
+	for _, credential := range nc.names {
+		result.Credentials = append(result.Credentials, struct {
+			Name             string    `json:"name"`
+			VersionCreatedAt time.Time `json:"version_created_at"`
+		}{Name: credential})
+	}
+	return result, nil
+}
+
+func (nc *namedCredhub) GetJsonByName(name string) (map[string]any, error) {
+	if name == "/prefix/failing" {
+		return nil, errors.New("no data")
+	}
+	return map[string]any{"name": name}, nil
+}
+
+func TestGetJsonIfExists(t *testing.T) {
+	client := &namedCredhub{names: []string{"/prefix/app", "/prefix/app-other", "/prefix/failing"}}
+
+	if value, e := GetJsonIfExists(client, "/prefix/app"); e != nil || value["name"] != "/prefix/app" {
+		t.Errorf("expected the credential to be read, got %v %v", value, e)
+	}
+	if value, e := GetJsonIfExists(client, "/prefix/ap"); e != nil || value != nil {
+		t.Errorf("expected credentials only matching by prefix to be missing, got %v %v", value, e)
+	}
+	if _, e := GetJsonIfExists(client, "/prefix/failing"); e == nil {
+		t.Errorf("expected failures reading existing credentials to be reported")
+	}
+}
@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gomatbase/csn"
 	"github.com/rabobank/config-hub/cfg"
+	"github.com/rabobank/config-hub/masking"
 )
 
 var (
@@ -23,6 +25,7 @@ type HttpRequest struct {
 	tlsOptions *tls.Config
 	e          error
 	content    io.Reader
+	timeout    time.Duration
 }
 
 func Request(urlComponents ...string) *HttpRequest {
@@ -89,6 +92,12 @@ func (r *HttpRequest) IgnoringSsl(ignore bool) *HttpRequest {
 	return r
 }
 
+// WithTimeout limits the duration of the whole exchange, reading the response body included. No timeout by default.
+func (r *HttpRequest) WithTimeout(timeout time.Duration) *HttpRequest {
+	r.timeout = timeout
+	return r
+}
+
 func (r *HttpRequest) WithContent(content []byte) *HttpRequest {
 	r.content = bytes.NewReader(content)
 	return r
@@ -104,7 +113,7 @@ func (r *HttpRequest) DoWithResponse(method string) (*http.Response, error) {
 		return nil, e
 	}
 
-	client := http.Client{}
+	client := http.Client{Timeout: r.timeout}
 	if r.tlsOptions != nil {
 		client.Transport = &http.Transport{TLSClientConfig: r.tlsOptions}
 	}
@@ -129,7 +138,7 @@ func (r *HttpRequest) Do(method string) ([]byte, error) {
 	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusBadRequest {
 		body, e := io.ReadAll(response.Body)
 		fmt.Println(e)
-		fmt.Println(string(body))
+		fmt.Println(masking.Json(body))
 		return nil, errors.New("failed request")
 	}
 
@@ -193,18 +202,17 @@ func (r *HttpRequest) PostJsonExchange(object any, result any) error {
 		body, e := io.ReadAll(response.Body)
 		cfg.Println(response.StatusCode)
 		cfg.Println(e)
-		cfg.Println(string(body))
+		cfg.Println(masking.Json(body))
 		return errors.New("failed request")
 	}
 
 	body, e := io.ReadAll(response.Body)
 	cfg.Println("body read error : ", e)
-	cfg.Println("read body : ", string(body))
+	cfg.Println("read body : ", masking.Json(body))
 
 	e = json.Unmarshal(body, result)
 
 	cfg.Println("decode error : ", e)
-	cfg.Println("decoded body :", result)
 
 	if e = json.NewDecoder(response.Body).Decode(result); e != nil && e != io.EOF {
 		return e
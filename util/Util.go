@@ -1,9 +1,5 @@
 package util
 
-import (
-	"github.com/rabobank/credhub-client"
-)
-
 func HasApplication(apps []string) bool {
 	for _, app := range apps {
 		if app == "application" {
@@ -19,14 +15,3 @@ func EmptyIfNil(str *string) string {
 	}
 	return *str
 }
-
-func CredhubClient(client, secret *string) (c credhub.Client, e error) {
-	if client != nil && secret != nil {
-		return credhub.New(&credhub.Options{
-			Client: *client,
-			Secret: *secret,
-		})
-	} else {
-		return credhub.New(nil)
-	}
-}